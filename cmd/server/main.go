@@ -5,9 +5,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/arihershowitz/translate-xhtml-local/internal/api"
+	"github.com/arihershowitz/translate-xhtml-local/internal/coalesce"
+	"github.com/arihershowitz/translate-xhtml-local/internal/glossary"
 	"github.com/arihershowitz/translate-xhtml-local/internal/llm"
+	"github.com/arihershowitz/translate-xhtml-local/internal/memory"
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
 	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
 	httpSwagger "github.com/swaggo/http-swagger"
 
@@ -22,16 +29,135 @@ func main() {
 
 	var (
 		port        = flag.String("port", defaultPort, "Server port")
-		llmEndpoint = flag.String("llm-url", "http://localhost:11434/api/generate", "Local LLM endpoint")
+		llmProvider = flag.String("llm-provider", "ollama", "API of the LLM server: ollama (/api/generate), ollama-chat (/api/chat), llamacpp (/completion) or openai (/v1/chat/completions)")
+		llmEndpoint = flag.String("llm-url", "", "Local LLM endpoint (defaults to the provider's local endpoint)")
 		llmModel    = flag.String("model", "google/translategemma-4b-it", "Model name to use")
+		apiKey      = flag.String("api-key", os.Getenv("LLM_API_KEY"), "Bearer token sent to the LLM server (defaults to $LLM_API_KEY)")
+		maxTokens   = flag.Int("max-tokens", 0, "Maximum tokens per model reply (0 uses the server's default)")
+		seed        = flag.Int("seed", -1, "Sampling seed sent to the LLM server (-1 sends none)")
+		timeout     = flag.Duration("timeout", 60*time.Second, "Timeout of a single LLM request")
+		maxAttempts = flag.Int("max-attempts", llm.DefaultRetryPolicy.MaxAttempts, "Attempts at an LLM request failing with a transient error, including the first")
+		keepAlive   = flag.String("keep-alive", "", "How long Ollama keeps the model loaded, e.g. 30m, or -1 for ever (empty uses the server's default)")
+		output      = flag.String("output", "text", "LLM reply format: text, or json for schema-constrained replies")
+		prompts     = flag.String("prompts", "", "Directory of *.tmpl prompt templates added to, or replacing, the built-in ones")
+		skip        = flag.String("skip", "code, pre, kbd, samp, var", "Comma-separated CSS-like selectors of elements left untranslated")
+		memoryPath  = flag.String("memory", "", "Path of the translation memory file (disabled if empty)")
+		cacheSize   = flag.Int("cache-size", coalesce.DefaultCacheSize, "Number of recent translations kept in memory (0 disables the cache; identical concurrent requests still share a model call)")
+		batch       = flag.Bool("batch", false, "Send several segments per LLM request")
+		batchTokens = flag.Int("batch-tokens", 0, "Token budget of a batched request (0 uses the model's default)")
+		slots       = flag.Bool("slots", false, "Mask numbers, times, dates and units out of the text sent to the model and refill them in its translation")
+		protect     = flag.Bool("protect", false, "Protect numbers, times, URLs, email addresses, codes and format placeholders from the model")
+		concurrency = flag.Int("concurrency", 0, "Fixed number of concurrent LLM requests across all translations (0 adapts it to the LLM server's latency)")
+		minParallel = flag.Int("min-concurrency", translator.DefaultConcurrency, "Concurrent LLM requests the adaptive limit starts at and never drops below")
+		maxParallel = flag.Int("max-concurrency", 32, "Maximum concurrent LLM requests the adaptive limit grows to")
 	)
+	var protectPatterns []*regexp.Regexp
+	flag.Func("protect-pattern", "Regular expression of further text to protect from the model (repeatable; implies -protect)", func(s string) error {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return err
+		}
+		protectPatterns = append(protectPatterns, re)
+		return nil
+	})
+	terms := glossary.New()
+	flag.Func("glossary", "CSV or TBX glossary file of mandated term translations (repeatable)", func(path string) error {
+		n, err := terms.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded %d glossary terms from %s", n, path)
+		return nil
+	})
 	flag.Parse()
 
+	skipSelectors, err := translator.ParseSelectors(*skip)
+	if err != nil {
+		log.Fatalf("Invalid -skip: %v", err)
+	}
+
+	outputMode, err := llm.ParseOutputMode(*output)
+	if err != nil {
+		log.Fatalf("Invalid -output: %v", err)
+	}
+
+	provider, err := llm.ParseProvider(*llmProvider)
+	if err != nil {
+		log.Fatalf("Invalid -llm-provider: %v", err)
+	}
+	if *llmEndpoint == "" {
+		*llmEndpoint = llm.DefaultEndpoint(provider)
+	}
+
+	templates, err := prompt.Load(*prompts)
+	if err != nil {
+		log.Fatalf("Invalid -prompts: %v", err)
+	}
+
 	// Initialize LLM client
-	llmClient := llm.NewClient(*llmEndpoint, *llmModel)
+	clientOpts := []llm.ClientOption{
+		llm.WithProvider(provider),
+		llm.WithOutputMode(outputMode),
+		llm.WithPromptTemplates(templates),
+		llm.WithAPIKey(*apiKey),
+		llm.WithMaxTokens(*maxTokens),
+		llm.WithTimeout(*timeout),
+	}
+	retry := llm.DefaultRetryPolicy
+	retry.MaxAttempts = *maxAttempts
+	clientOpts = append(clientOpts, llm.WithRetryPolicy(retry))
+	if *seed >= 0 {
+		clientOpts = append(clientOpts, llm.WithSeed(*seed))
+	}
+	if *keepAlive != "" {
+		d, err := parseKeepAlive(*keepAlive)
+		if err != nil {
+			log.Fatalf("Invalid -keep-alive: %v", err)
+		}
+		clientOpts = append(clientOpts, llm.WithKeepAlive(d))
+	}
+	client := llm.NewClient(*llmEndpoint, *llmModel, clientOpts...)
+	name, hash := client.PromptTemplate()
+	log.Printf("Using prompt template %s (%s)", name, hash)
+	var llmClient translator.LLMClient = client
+
+	// Wrap it with the translation memory
+	if *memoryPath != "" {
+		store, err := memory.Open(*memoryPath)
+		if err != nil {
+			log.Fatalf("Failed to open translation memory: %v", err)
+		}
+		defer store.Close()
+		llmClient = memory.NewClient(llmClient, store)
+		log.Printf("Using translation memory at %s", *memoryPath)
+	}
+
+	// Share model calls between identical requests
+	llmClient = coalesce.NewClient(llmClient, *cacheSize)
+
+	// Limit concurrent LLM requests, adaptively unless a fixed limit is set
+	scheduler := translator.NewScheduler(*concurrency)
+	if *concurrency <= 0 {
+		scheduler = translator.NewAdaptiveScheduler(*minParallel, *maxParallel)
+		log.Printf("Adapting LLM concurrency to the server's latency, from %d up to %d requests", *minParallel, *maxParallel)
+	}
 
 	// Initialize Translator Service
-	translationService := translator.NewService(llmClient)
+	serviceOpts := []translator.ServiceOption{
+		translator.WithSkipSelectors(skipSelectors),
+		translator.WithScheduler(scheduler),
+		translator.WithGlossary(terms),
+	}
+	if *batch {
+		serviceOpts = append(serviceOpts, translator.WithBatching(*batchTokens))
+	}
+	if *slots {
+		serviceOpts = append(serviceOpts, translator.WithTemplateSlots())
+	}
+	if *protect || len(protectPatterns) > 0 {
+		serviceOpts = append(serviceOpts, translator.WithProtectedPatterns(protectPatterns...))
+	}
+	translationService := translator.NewService(llmClient, serviceOpts...)
 
 	// Initialize API Handler
 	handler := api.NewHandler(translationService)
@@ -39,15 +165,30 @@ func main() {
 	// Setup Routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/translate", handler.Translate)
+	mux.HandleFunc("/stats", handler.Stats)
+	glossaryHandler := api.NewGlossaryHandler(terms)
+	mux.HandleFunc("GET /glossary", glossaryHandler.List)
+	mux.HandleFunc("POST /glossary", glossaryHandler.Add)
+	mux.HandleFunc("DELETE /glossary", glossaryHandler.Remove)
+	mux.HandleFunc("POST /glossary/import", glossaryHandler.Import)
 
 	// Serve Swagger UI
 	mux.HandleFunc("/swagger/", httpSwagger.WrapHandler)
 
 	log.Printf("Starting server on port %s", *port)
-	log.Printf("Using LLM at %s with model %s", *llmEndpoint, *llmModel)
+	log.Printf("Using %s LLM at %s with model %s", provider, *llmEndpoint, *llmModel)
 	log.Printf("Swagger UI available at http://localhost:%s/swagger/index.html", *port)
 
 	if err := http.ListenAndServe(":"+*port, mux); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// parseKeepAlive parses a duration, or a plain number of seconds as Ollama
+// accepts it, so that "-1" keeps the model loaded indefinitely.
+func parseKeepAlive(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
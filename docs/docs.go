@@ -15,6 +15,226 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/glossary": {
+            "get": {
+                "description": "Lists the glossary terms of a language pair, or of all pairs, as JSON or as a CSV file that can be imported again.",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "glossary"
+                ],
+                "summary": "List glossary terms",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Source language of the terms (requires target_lang)",
+                        "name": "source_lang",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target language of the terms (requires source_lang)",
+                        "name": "target_lang",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Response format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_glossary.Term"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a mandated translation of a term for a language pair, replacing the term's previous translation. An empty target marks a term that must not be translated.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "glossary"
+                ],
+                "summary": "Add a glossary term",
+                "parameters": [
+                    {
+                        "description": "Glossary term",
+                        "name": "term",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_glossary.Term"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a term from the glossary of a language pair.",
+                "tags": [
+                    "glossary"
+                ],
+                "summary": "Remove a glossary term",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Source language of the term",
+                        "name": "source_lang",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target language of the term",
+                        "name": "target_lang",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Term to remove",
+                        "name": "source",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/glossary/import": {
+            "post": {
+                "description": "Adds the terms of a CSV file (columns source_lang, target_lang, source and target) or a TBX file, replacing the translations of terms already in the glossary. If any term is invalid, none are added.",
+                "consumes": [
+                    "text/csv",
+                    "application/x-tbx+xml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "glossary"
+                ],
+                "summary": "Import a glossary file",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "tbx"
+                        ],
+                        "type": "string",
+                        "description": "File format",
+                        "name": "format",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "Glossary file",
+                        "name": "file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_api.GlossaryImportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/stats": {
+            "get": {
+                "description": "Reports the current limit on concurrent LLM requests, the requests running and waiting, the observed LLM latencies, and the requests served by coalescing or the cache.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "introspection"
+                ],
+                "summary": "Report the service's state",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.Stats"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
         "/translate": {
             "post": {
                 "description": "Translates XHTML content from source language to target language using a local LLM.",
@@ -69,20 +289,296 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "github_com_arihershowitz_translate-xhtml-local_internal_glossary.Term": {
+            "type": "object",
+            "properties": {
+                "source": {
+                    "type": "string"
+                },
+                "source_lang": {
+                    "description": "SourceLang and TargetLang are BCP 47 tags, e.g. \"en\" and \"pt-BR\".",
+                    "type": "string"
+                },
+                "target": {
+                    "description": "Target is the translation of Source. A term whose Target is its\nSource must not be translated.",
+                    "type": "string"
+                },
+                "target_lang": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.CacheStats": {
+            "type": "object",
+            "properties": {
+                "coalesced": {
+                    "description": "Coalesced counts the requests that shared the model call of an\nidentical request in flight, and Hits those served from the results\nof recent requests.",
+                    "type": "integer"
+                },
+                "entries": {
+                    "description": "Entries is the number of results held.",
+                    "type": "integer"
+                },
+                "hits": {
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.DedupeStats": {
+            "type": "object",
+            "properties": {
+                "ratio": {
+                    "description": "Ratio is the fraction of segments that took the translation of an\nearlier one.",
+                    "type": "number"
+                },
+                "segments": {
+                    "type": "integer"
+                },
+                "unique": {
+                    "description": "Unique is the number of distinct texts among the segments.",
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.Format": {
+            "type": "string",
+            "enum": [
+                "auto",
+                "html",
+                "xhtml"
+            ],
+            "x-enum-varnames": [
+                "FormatAuto",
+                "FormatHTML",
+                "FormatXHTML"
+            ]
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.GlossaryViolation": {
+            "type": "object",
+            "properties": {
+                "path": {
+                    "description": "Path locates the element holding the segment, as in SegmentFailure.",
+                    "type": "string"
+                },
+                "segment": {
+                    "description": "Segment is the index of the segment in document order.",
+                    "type": "integer"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "term": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.LatencyStats": {
+            "type": "object",
+            "properties": {
+                "baseline": {
+                    "type": "integer"
+                },
+                "p50": {
+                    "description": "P50 and P95 are percentiles of the last latencyWindow requests.",
+                    "type": "integer"
+                },
+                "p95": {
+                    "type": "integer"
+                },
+                "recent": {
+                    "description": "Recent is the moving average latency per estimated token of the last\nten or so requests, and Baseline the latency per token the limit\nadapts against. Both count requestOverhead tokens per request.",
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.MemoryStats": {
+            "type": "object",
+            "properties": {
+                "hits": {
+                    "type": "integer"
+                },
+                "misses": {
+                    "type": "integer"
+                }
+            }
+        },
         "github_com_arihershowitz_translate-xhtml-local_internal_translator.Metadata": {
             "type": "object",
             "properties": {
+                "dedupe": {
+                    "description": "Dedupe reports the segments that took the translation of an earlier\nsegment with the same text instead of a model request of their own.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.DedupeStats"
+                        }
+                    ]
+                },
                 "duration": {
                     "type": "integer"
                 },
+                "failures": {
+                    "description": "Failures lists the segments left in the source language in\nBestEffort mode, and in either mode those whose translation the\nValidator rejected.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.SegmentFailure"
+                    }
+                },
+                "format": {
+                    "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.Format"
+                },
+                "glossary_violations": {
+                    "description": "GlossaryViolations lists the glossary terms whose mandated\ntranslation is missing from the translation of their segment, with\nWithGlossary.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.GlossaryViolation"
+                    }
+                },
+                "memory": {
+                    "description": "Memory counts translation memory hits and misses; it is omitted when\nthe LLMClient is not wrapped in a translation memory.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.MemoryStats"
+                        }
+                    ]
+                },
                 "model": {
                     "type": "string"
                 },
+                "priority": {
+                    "description": "Priority is the scheduling class the call ran in.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.Priority"
+                        }
+                    ]
+                },
+                "prompt_hash": {
+                    "type": "string"
+                },
+                "prompt_template": {
+                    "description": "PromptTemplate and PromptHash identify the prompt template the\nLLMClient built its prompts from, if it implements PromptTemplater.",
+                    "type": "string"
+                },
+                "rejected": {
+                    "description": "Rejected counts the segments left in the source language because\nthe Validator rejected the model's output; they are listed in\nFailures too.",
+                    "type": "integer"
+                },
+                "retries": {
+                    "description": "Retries lists the segments whose model requests had to be retried,\nas reported by the LLMClient with RecordRetry. The retries of a\nbatched request count for each of its segments.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.SegmentRetries"
+                    }
+                },
                 "timestamp": {
                     "type": "string"
                 }
             }
         },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.Priority": {
+            "type": "string",
+            "enum": [
+                "auto",
+                "interactive",
+                "batch"
+            ],
+            "x-enum-varnames": [
+                "PriorityAuto",
+                "PriorityInteractive",
+                "PriorityBatch"
+            ]
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.SchedulerStats": {
+            "type": "object",
+            "properties": {
+                "adaptive": {
+                    "description": "Adaptive is set if the limit adapts to the model server.",
+                    "type": "boolean"
+                },
+                "latency": {
+                    "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.LatencyStats"
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "max_limit": {
+                    "type": "integer"
+                },
+                "min_limit": {
+                    "type": "integer"
+                },
+                "overloads": {
+                    "description": "Overloads counts the requests the server refused or timed out for\nbeing overloaded.",
+                    "type": "integer"
+                },
+                "running": {
+                    "description": "Running is the number of model requests in flight and Waiting the\nnumber waiting for a slot.",
+                    "type": "integer"
+                },
+                "waiting": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.SegmentFailure": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path locates the element holding the segment, as an XPath such as\n\"/html[1]/body[1]/p[2]\", followed by \"/@name\" for an attribute.",
+                    "type": "string"
+                },
+                "segment": {
+                    "description": "Segment is the index of the segment in document order.",
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.SegmentRetries": {
+            "type": "object",
+            "properties": {
+                "retries": {
+                    "type": "integer"
+                },
+                "segment": {
+                    "description": "Segment is the index of the segment in document order.",
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arihershowitz_translate-xhtml-local_internal_translator.Stats": {
+            "type": "object",
+            "properties": {
+                "cache": {
+                    "description": "Cache counts the requests the LLMClient served without a model call\nof their own, if it implements CacheReporter.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.CacheStats"
+                        }
+                    ]
+                },
+                "scheduler": {
+                    "$ref": "#/definitions/github_com_arihershowitz_translate-xhtml-local_internal_translator.SchedulerStats"
+                }
+            }
+        },
+        "internal_api.GlossaryImportResponse": {
+            "type": "object",
+            "properties": {
+                "imported": {
+                    "description": "Imported is the number of terms added or replaced.",
+                    "type": "integer"
+                }
+            }
+        },
         "internal_api.TranslationRequest": {
             "type": "object",
             "required": [
@@ -91,10 +587,63 @@ const docTemplate = `{
                 "xhtml"
             ],
             "properties": {
+                "failure_mode": {
+                    "description": "FailureMode controls what happens when a segment cannot be\ntranslated: \"fail-fast\" (default) fails the request, \"best-effort\"\nleaves the segment in the source language and reports it in\nfailures.",
+                    "type": "string",
+                    "enum": [
+                        "fail-fast",
+                        "best-effort"
+                    ]
+                },
+                "format": {
+                    "description": "Format selects the parser and serializer: \"xhtml\" produces well-formed\nXML, \"html\" uses HTML5 rules, \"auto\" (default) picks xhtml for input\nwith an XML declaration or the XHTML namespace.",
+                    "type": "string",
+                    "enum": [
+                        "auto",
+                        "html",
+                        "xhtml"
+                    ]
+                },
+                "fragment": {
+                    "description": "Fragment translates the input as a snippet: the output is not wrapped\nin html/head/body and has exactly the shape of the input.",
+                    "type": "boolean"
+                },
+                "fragment_context": {
+                    "description": "FragmentContext is the element the fragment is parsed in, e.g. \"tbody\"\nfor table rows or \"ul\" for list items. Defaults to \"body\".",
+                    "type": "string"
+                },
+                "mark_failures": {
+                    "description": "MarkFailures sets data-translation-failed on the elements of\nsegments that failed in best-effort mode.",
+                    "type": "boolean"
+                },
+                "memory": {
+                    "description": "Memory controls the translation memory: \"use\" (default) serves and\nstores translations, \"bypass\" ignores the memory and \"refresh\"\nreplaces stored translations with new ones.",
+                    "type": "string",
+                    "enum": [
+                        "use",
+                        "bypass",
+                        "refresh"
+                    ]
+                },
+                "minimal_diff": {
+                    "description": "MinimalDiff splices translations into the original markup, leaving\nevery byte outside the translated text untouched.",
+                    "type": "boolean"
+                },
+                "priority": {
+                    "description": "Priority is the scheduling class of the request's model calls:\n\"interactive\" ones are served before \"batch\" ones. \"auto\" (default)\ntreats documents of up to 20 segments as interactive.",
+                    "type": "string",
+                    "enum": [
+                        "auto",
+                        "interactive",
+                        "batch"
+                    ]
+                },
                 "source_lang": {
+                    "description": "SourceLang is the BCP 47 tag of the input's language, e.g. \"en\".",
                     "type": "string"
                 },
                 "target_lang": {
+                    "description": "TargetLang is the BCP 47 tag to translate into, e.g. \"pt-BR\" or\n\"zh-Hant\".",
                     "type": "string"
                 },
                 "xhtml": {
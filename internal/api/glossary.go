@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/glossary"
+)
+
+// GlossaryImportResponse represents the response body for a glossary
+// import.
+type GlossaryImportResponse struct {
+	// Imported is the number of terms added or replaced.
+	Imported int `json:"imported"`
+}
+
+// GlossaryHandler handles the API requests managing a glossary. Changes
+// last until the server restarts; export the glossary as CSV to keep them.
+type GlossaryHandler struct {
+	glossary *glossary.Glossary
+}
+
+// NewGlossaryHandler creates a new handler managing g.
+func NewGlossaryHandler(g *glossary.Glossary) *GlossaryHandler {
+	return &GlossaryHandler{glossary: g}
+}
+
+// List godoc
+// @Summary List glossary terms
+// @Description Lists the glossary terms of a language pair, or of all pairs, as JSON or as a CSV file that can be imported again.
+// @Tags glossary
+// @Produce json
+// @Produce text/csv
+// @Param source_lang query string false "Source language of the terms (requires target_lang)"
+// @Param target_lang query string false "Target language of the terms (requires source_lang)"
+// @Param format query string false "Response format" Enums(json, csv)
+// @Success 200 {array} glossary.Term
+// @Failure 400 {object} map[string]string
+// @Router /glossary [get]
+func (h *GlossaryHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sourceLang, targetLang := q.Get("source_lang"), q.Get("target_lang")
+	if (sourceLang == "") != (targetLang == "") {
+		http.Error(w, "source_lang and target_lang go together", http.StatusBadRequest)
+		return
+	}
+	terms := h.glossary.List(sourceLang, targetLang)
+
+	switch q.Get("format") {
+	case "", "json":
+		if terms == nil {
+			terms = []glossary.Term{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(terms); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="glossary.csv"`)
+		if err := glossary.WriteCSV(w, terms); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	default:
+		http.Error(w, "Invalid format (expected json or csv)", http.StatusBadRequest)
+	}
+}
+
+// Add godoc
+// @Summary Add a glossary term
+// @Description Adds a mandated translation of a term for a language pair, replacing the term's previous translation. An empty target marks a term that must not be translated.
+// @Tags glossary
+// @Accept json
+// @Param term body glossary.Term true "Glossary term"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /glossary [post]
+func (h *GlossaryHandler) Add(w http.ResponseWriter, r *http.Request) {
+	var term glossary.Term
+	if err := json.NewDecoder(r.Body).Decode(&term); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.glossary.Add(term); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Remove godoc
+// @Summary Remove a glossary term
+// @Description Removes a term from the glossary of a language pair.
+// @Tags glossary
+// @Param source_lang query string true "Source language of the term"
+// @Param target_lang query string true "Target language of the term"
+// @Param source query string true "Term to remove"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /glossary [delete]
+func (h *GlossaryHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !h.glossary.Remove(q.Get("source_lang"), q.Get("target_lang"), q.Get("source")) {
+		http.Error(w, "No such term", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Import godoc
+// @Summary Import a glossary file
+// @Description Adds the terms of a CSV file (columns source_lang, target_lang, source and target) or a TBX file, replacing the translations of terms already in the glossary. If any term is invalid, none are added.
+// @Tags glossary
+// @Accept text/csv
+// @Accept application/x-tbx+xml
+// @Produce json
+// @Param format query string true "File format" Enums(csv, tbx)
+// @Param file body string true "Glossary file"
+// @Success 200 {object} GlossaryImportResponse
+// @Failure 400 {object} map[string]string
+// @Router /glossary/import [post]
+func (h *GlossaryHandler) Import(w http.ResponseWriter, r *http.Request) {
+	format, err := glossary.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n, err := h.glossary.Load(r.Body, format)
+	if err != nil {
+		http.Error(w, "Import failed, no terms were added: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GlossaryImportResponse{Imported: n}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/glossary"
+)
+
+// serve sends a request to handle and returns the response.
+func serve(handle http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handle(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestGlossaryHandler_List(t *testing.T) {
+	g := glossary.New()
+	for _, term := range []glossary.Term{
+		{SourceLang: "en", TargetLang: "es", Source: "Heat index", Target: "Índice de calor"},
+		{SourceLang: "en", TargetLang: "fr", Source: "Heat index", Target: "Indice de chaleur"},
+	} {
+		if err := g.Add(term); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewGlossaryHandler(g)
+
+	w := serve(h.List, http.MethodGet, "/glossary?source_lang=en&target_lang=es", "")
+	var terms []glossary.Term
+	if err := json.NewDecoder(w.Body).Decode(&terms); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected a JSON list, got %d (%v)", w.Code, err)
+	}
+	want := []glossary.Term{{SourceLang: "en", TargetLang: "es", Source: "Heat index", Target: "Índice de calor"}}
+	if !reflect.DeepEqual(terms, want) {
+		t.Errorf("Expected %+v, got %+v", want, terms)
+	}
+
+	w = serve(h.List, http.MethodGet, "/glossary?format=csv", "")
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "text/csv" {
+		t.Fatalf("Expected a CSV file, got %d %q", w.Code, ct)
+	}
+	if n := strings.Count(w.Body.String(), "\n"); n != 3 {
+		t.Errorf("Expected a header and 2 terms, got %q", w.Body.String())
+	}
+
+	// An unknown pair has no terms.
+	w = serve(h.List, http.MethodGet, "/glossary?source_lang=en&target_lang=de", "")
+	if body := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || body != "[]" {
+		t.Errorf("Expected an empty list, got %d %q", w.Code, body)
+	}
+}
+
+func TestGlossaryHandler_BadRequests(t *testing.T) {
+	h := NewGlossaryHandler(glossary.New())
+	tests := []struct {
+		name   string
+		handle http.HandlerFunc
+		method string
+		target string
+		body   string
+	}{
+		{"source without target", h.List, http.MethodGet, "/glossary?source_lang=en", ""},
+		{"unknown list format", h.List, http.MethodGet, "/glossary?format=xml", ""},
+		{"invalid body", h.Add, http.MethodPost, "/glossary", "{"},
+		{"bad language tag", h.Add, http.MethodPost, "/glossary", `{"source_lang": "en", "target_lang": "not a tag!", "source": "Heat index"}`},
+		{"missing source", h.Add, http.MethodPost, "/glossary", `{"source_lang": "en", "target_lang": "es"}`},
+		{"unknown import format", h.Import, http.MethodPost, "/glossary/import?format=xlsx", "source_lang,target_lang,source\n"},
+		{"bad import row", h.Import, http.MethodPost, "/glossary/import?format=csv", "source_lang,target_lang,source\nen,??,Heat index\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(tt.handle, tt.method, tt.target, tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d (%q)", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGlossaryHandler_AddRemove(t *testing.T) {
+	g := glossary.New()
+	h := NewGlossaryHandler(g)
+
+	w := serve(h.Add, http.MethodPost, "/glossary", `{"source_lang": "en-us", "target_lang": "es", "source": "Heat index", "target": "Índice de calor"}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d (%q)", w.Code, w.Body.String())
+	}
+	want := []glossary.Term{{SourceLang: "en-US", TargetLang: "es", Source: "Heat index", Target: "Índice de calor"}}
+	if terms := g.List("en-US", "es"); !reflect.DeepEqual(terms, want) {
+		t.Errorf("Expected %+v, got %+v", want, terms)
+	}
+
+	target := "/glossary?source_lang=en-US&target_lang=es&source=heat+index"
+	if w := serve(h.Remove, http.MethodDelete, target, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	if w := serve(h.Remove, http.MethodDelete, target, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a removed term, got %d", w.Code)
+	}
+	if terms := g.List("", ""); terms != nil {
+		t.Errorf("Expected an empty glossary, got %+v", terms)
+	}
+}
+
+func TestGlossaryHandler_Import(t *testing.T) {
+	g := glossary.New()
+	h := NewGlossaryHandler(g)
+
+	file := "source_lang,target_lang,source,target\nen,es,Heat index,Índice de calor\nen,es,NWS,\n"
+	w := serve(h.Import, http.MethodPost, "/glossary/import?format=csv", file)
+	var resp GlossaryImportResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected an import response, got %d (%v)", w.Code, err)
+	}
+	if resp.Imported != 2 {
+		t.Errorf("Expected 2 imported terms, got %d", resp.Imported)
+	}
+	if terms := g.List("en", "es"); len(terms) != 2 || terms[1].Target != "NWS" {
+		t.Errorf("Expected the terms added, NWS untranslated, got %+v", terms)
+	}
+
+	// A file with an invalid term changes nothing.
+	file = "source_lang,target_lang,source,target\nen,fr,Heat index,Indice de chaleur\nen,??,NWS,\n"
+	if w := serve(h.Import, http.MethodPost, "/glossary/import?format=csv", file); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if terms := g.List("en", "fr"); terms != nil {
+		t.Errorf("Expected no terms added, got %+v", terms)
+	}
+}
@@ -7,14 +7,47 @@ import (
 	"strings"
 	"time"
 
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
 	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
 )
 
 // TranslationRequest represents the request body for translation.
 type TranslationRequest struct {
-	XHTML      string `json:"xhtml" binding:"required"`
+	XHTML string `json:"xhtml" binding:"required"`
+	// SourceLang is the BCP 47 tag of the input's language, e.g. "en".
 	SourceLang string `json:"source_lang" binding:"required"`
+	// TargetLang is the BCP 47 tag to translate into, e.g. "pt-BR" or
+	// "zh-Hant".
 	TargetLang string `json:"target_lang" binding:"required"`
+	// Format selects the parser and serializer: "xhtml" produces well-formed
+	// XML, "html" uses HTML5 rules, "auto" (default) picks xhtml for input
+	// with an XML declaration or the XHTML namespace.
+	Format string `json:"format,omitempty" enums:"auto,html,xhtml"`
+	// Fragment translates the input as a snippet: the output is not wrapped
+	// in html/head/body and has exactly the shape of the input.
+	Fragment bool `json:"fragment,omitempty"`
+	// FragmentContext is the element the fragment is parsed in, e.g. "tbody"
+	// for table rows or "ul" for list items. Defaults to "body".
+	FragmentContext string `json:"fragment_context,omitempty"`
+	// MinimalDiff splices translations into the original markup, leaving
+	// every byte outside the translated text untouched.
+	MinimalDiff bool `json:"minimal_diff,omitempty"`
+	// Memory controls the translation memory: "use" (default) serves and
+	// stores translations, "bypass" ignores the memory and "refresh"
+	// replaces stored translations with new ones.
+	Memory string `json:"memory,omitempty" enums:"use,bypass,refresh"`
+	// FailureMode controls what happens when a segment cannot be
+	// translated: "fail-fast" (default) fails the request, "best-effort"
+	// leaves the segment in the source language and reports it in
+	// failures.
+	FailureMode string `json:"failure_mode,omitempty" enums:"fail-fast,best-effort"`
+	// MarkFailures sets data-translation-failed on the elements of
+	// segments that failed in best-effort mode.
+	MarkFailures bool `json:"mark_failures,omitempty"`
+	// Priority is the scheduling class of the request's model calls:
+	// "interactive" ones are served before "batch" ones. "auto" (default)
+	// treats documents of up to 20 segments as interactive.
+	Priority string `json:"priority,omitempty" enums:"auto,interactive,batch"`
 }
 
 // TranslationResponse represents the response body for translation.
@@ -56,10 +89,61 @@ func (h *Handler) Translate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sourceLang, err := lang.Canonicalize(req.SourceLang)
+	if err != nil {
+		http.Error(w, "Invalid source_lang: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targetLang, err := lang.Canonicalize(req.TargetLang)
+	if err != nil {
+		http.Error(w, "Invalid target_lang: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := translator.ParseFormat(req.Format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	memory, err := translator.ParseMemoryPolicy(req.Memory)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	failureMode, err := translator.ParseFailureMode(req.FailureMode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	priority, err := translator.ParsePriority(req.Priority)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 	defer cancel()
 
-	translated, metadata, err := h.service.Translate(ctx, strings.NewReader(req.XHTML), req.SourceLang, req.TargetLang)
+	opts := []translator.Option{
+		translator.WithFormat(format),
+		translator.WithMemoryPolicy(memory),
+		translator.WithFailureMode(failureMode),
+		translator.WithPriority(priority),
+	}
+	if req.Fragment || req.FragmentContext != "" {
+		opts = append(opts, translator.WithFragment(req.FragmentContext))
+	}
+	if req.MinimalDiff {
+		opts = append(opts, translator.WithMinimalDiff())
+	}
+	if req.MarkFailures {
+		opts = append(opts, translator.WithFailureMarking())
+	}
+
+	translated, metadata, err := h.service.Translate(ctx, strings.NewReader(req.XHTML), sourceLang, targetLang, opts...)
 	if err != nil {
 		http.Error(w, "Translation failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -75,3 +159,29 @@ func (h *Handler) Translate(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// statsReporter is implemented by services that report their state.
+type statsReporter interface {
+	Stats() translator.Stats
+}
+
+// Stats godoc
+// @Summary Report the service's state
+// @Description Reports the current limit on concurrent LLM requests, the requests running and waiting, the observed LLM latencies, and the requests served by coalescing or the cache.
+// @Tags introspection
+// @Produce json
+// @Success 200 {object} translator.Stats
+// @Failure 404 {object} map[string]string
+// @Router /stats [get]
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	sr, ok := h.service.(statsReporter)
+	if !ok {
+		http.Error(w, "Stats not available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sr.Stats()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,241 @@
+// Package coalesce shares model calls between identical translation
+// requests: concurrent requests for the same text and language pair wait
+// for a single model call, and the results of recent requests are kept in
+// memory and served again.
+package coalesce
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
+)
+
+// DefaultCacheSize is the number of recent translations a Client keeps
+// unless configured otherwise.
+const DefaultCacheSize = 10000
+
+// key identifies the requests sharing a model call.
+type key struct {
+	text, sourceLang, targetLang string
+	// hints is a digest of the prompt hints of the request.
+	hints string
+}
+
+// newKey returns the key of a request for text made with ctx.
+func newKey(ctx context.Context, text, sourceLang, targetLang string) key {
+	return key{text, sourceLang, targetLang, hintsDigest(prompt.HintsFromContext(ctx))}
+}
+
+// hintsDigest returns a digest of h, or "" if h is empty.
+func hintsDigest(h prompt.Hints) string {
+	if h.Context == "" && len(h.Glossary) == 0 && len(h.Examples) == 0 {
+		return ""
+	}
+	d := sha256.New()
+	write := func(fields ...string) {
+		for _, f := range fields {
+			d.Write([]byte(f))
+			d.Write([]byte{0})
+		}
+	}
+	write(h.Context)
+	for _, t := range h.Glossary {
+		write("term", t.Source, t.Target)
+	}
+	for _, e := range h.Examples {
+		write("example", e.Source, e.Target)
+	}
+	return string(d.Sum(nil))
+}
+
+// call is a model call in flight, shared by the requests waiting on done.
+type call struct {
+	done       chan struct{}
+	translated string
+	err        error
+}
+
+// promptVersioner is implemented by LLM clients whose prompt is versioned.
+type promptVersioner interface {
+	PromptVersion() string
+}
+
+// Client wraps a translator.LLMClient, sharing model calls between
+// identical requests. Requests are identical if they have the same text,
+// language pair and prompt hints, such as glossary terms and context. The
+// cache follows the translator.MemoryPolicy of the request and only keeps
+// translations the translator accepts.
+type Client struct {
+	next  translator.LLMClient
+	cache *lru
+
+	mu    sync.Mutex
+	calls map[key]*call
+
+	requests, coalesced, hits atomic.Int64
+}
+
+// NewClient returns next wrapped to share model calls, keeping the results
+// of up to cacheSize recent requests. A cacheSize of 0 disables the cache;
+// concurrent requests still share model calls.
+func NewClient(next translator.LLMClient, cacheSize int) *Client {
+	return &Client{next: next, cache: newLRU(cacheSize), calls: make(map[key]*call)}
+}
+
+// GetModelName returns the model name of the wrapped client.
+func (c *Client) GetModelName() string {
+	return c.next.GetModelName()
+}
+
+// PromptVersion returns the prompt version of the wrapped client, if any.
+func (c *Client) PromptVersion() string {
+	if pv, ok := c.next.(promptVersioner); ok {
+		return pv.PromptVersion()
+	}
+	return ""
+}
+
+// PromptTemplate returns the prompt template of the wrapped client, if any.
+func (c *Client) PromptTemplate() (name, hash string) {
+	if pt, ok := c.next.(translator.PromptTemplater); ok {
+		return pt.PromptTemplate()
+	}
+	return "", ""
+}
+
+// CacheStats returns the number of requests served and how many of them
+// shared a model call or were served from the cache.
+func (c *Client) CacheStats() translator.CacheStats {
+	return translator.CacheStats{
+		Requests:  c.requests.Load(),
+		Coalesced: c.coalesced.Load(),
+		Hits:      c.hits.Load(),
+		Entries:   c.cache.len(),
+	}
+}
+
+// TranslateText returns the cached translation of text if there is one,
+// waits for the model call of an identical request in flight if there is
+// one, and otherwise translates text with the wrapped client.
+func (c *Client) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	c.requests.Add(1)
+	k := newKey(ctx, text, sourceLang, targetLang)
+	policy := translator.MemoryPolicyFromContext(ctx)
+	if policy == translator.MemoryUse {
+		if translated, ok := c.cache.get(k); ok {
+			c.hits.Add(1)
+			return translated, nil
+		}
+	}
+
+	for {
+		c.mu.Lock()
+		cl, ok := c.calls[k]
+		if !ok {
+			cl = &call{done: make(chan struct{})}
+			c.calls[k] = cl
+			c.mu.Unlock()
+			return c.do(ctx, k, cl, policy)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-cl.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if isContextErr(cl.err) && ctx.Err() == nil {
+			// The request making the call gave up, not the model; call it
+			// again.
+			continue
+		}
+		c.coalesced.Add(1)
+		return cl.translated, cl.err
+	}
+}
+
+// do makes the model call cl for the request k and hands the result to the
+// requests waiting for it.
+func (c *Client) do(ctx context.Context, k key, cl *call, policy translator.MemoryPolicy) (string, error) {
+	cl.translated, cl.err = c.next.TranslateText(ctx, k.text, k.sourceLang, k.targetLang)
+	if cl.err == nil && policy != translator.MemoryBypass {
+		c.keep(ctx, k, cl.translated)
+	}
+	c.mu.Lock()
+	delete(c.calls, k)
+	c.mu.Unlock()
+	close(cl.done)
+	return cl.translated, cl.err
+}
+
+// BatchTokenBudget returns the batch token budget of the wrapped client, or
+// 0 if it cannot batch.
+func (c *Client) BatchTokenBudget() int {
+	if bt, ok := c.next.(translator.BatchTranslator); ok {
+		return bt.BatchTokenBudget()
+	}
+	return 0
+}
+
+// TranslateBatch serves the texts found in the cache and sends the others
+// to the wrapped client as one batch. Batches do not share model calls with
+// other requests, but their accepted results are cached.
+func (c *Client) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	bt, ok := c.next.(translator.BatchTranslator)
+	if !ok {
+		return nil, errors.New("wrapped LLM client does not translate batches")
+	}
+	c.requests.Add(int64(len(texts)))
+	policy := translator.MemoryPolicyFromContext(ctx)
+
+	translations := make([]string, len(texts))
+	var missing []int
+	var missingTexts []string
+	for i, text := range texts {
+		if policy == translator.MemoryUse {
+			if translated, ok := c.cache.get(newKey(ctx, text, sourceLang, targetLang)); ok {
+				c.hits.Add(1)
+				translations[i] = translated
+				continue
+			}
+		}
+		missing = append(missing, i)
+		missingTexts = append(missingTexts, text)
+	}
+	if len(missing) == 0 {
+		return translations, nil
+	}
+
+	translated, err := bt.TranslateBatch(ctx, missingTexts, sourceLang, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	if len(translated) != len(missing) {
+		return nil, fmt.Errorf("got %d translations for %d texts", len(translated), len(missing))
+	}
+	for i, t := range translated {
+		translations[missing[i]] = t
+		if policy != translator.MemoryBypass {
+			c.keep(ctx, newKey(ctx, missingTexts[i], sourceLang, targetLang), t)
+		}
+	}
+	return translations, nil
+}
+
+// keep caches the translation of the request k once the translator
+// accepts it.
+func (c *Client) keep(ctx context.Context, k key, translated string) {
+	translator.KeepOnAccept(ctx, k.text, func() { c.cache.add(k, translated) })
+}
+
+// isContextErr reports whether err is the error of a cancelled or expired
+// context.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
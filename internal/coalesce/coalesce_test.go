@@ -0,0 +1,223 @@
+package coalesce
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
+)
+
+// blockingLLM counts the calls that reach the model, holding each until
+// release is closed.
+type blockingLLM struct {
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (m *blockingLLM) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	m.calls.Add(1)
+	select {
+	case <-m.release:
+		return targetLang + ":" + text, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (m *blockingLLM) GetModelName() string {
+	return "test-model"
+}
+
+// waitFor waits until cond holds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClient_Coalesces(t *testing.T) {
+	llm := &blockingLLM{release: make(chan struct{})}
+	c := NewClient(llm, DefaultCacheSize)
+
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if results[i], err = c.TranslateText(context.Background(), "Mostly sunny", "en", "es"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	// Another target language is another request.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.TranslateText(context.Background(), "Mostly sunny", "en", "fr")
+	}()
+	waitFor(t, func() bool { return llm.calls.Load() == 2 })
+	time.Sleep(10 * time.Millisecond)
+	close(llm.release)
+	wg.Wait()
+
+	for _, r := range results {
+		if r != "es:Mostly sunny" {
+			t.Errorf("Expected the shared translation, got %q", r)
+		}
+	}
+	if n := llm.calls.Load(); n != 2 {
+		t.Errorf("Expected 2 model calls, got %d", n)
+	}
+	// A request arriving after the call ended is served from the cache.
+	if got := c.CacheStats(); got.Requests != 6 || got.Coalesced+got.Hits != 4 || got.Entries != 2 {
+		t.Errorf("Expected 6 requests, 4 of them coalesced or cached, and 2 entries, got %+v", got)
+	}
+}
+
+func TestClient_Cache(t *testing.T) {
+	llm := &blockingLLM{release: make(chan struct{})}
+	close(llm.release)
+	c := NewClient(llm, 2)
+	ctx := context.Background()
+
+	for _, text := range []string{"One", "Two", "One", "Three", "One", "Two"} {
+		if _, err := c.TranslateText(ctx, text, "en", "es"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "Two" was evicted by "Three", "One" was not: it was used since.
+	if n := llm.calls.Load(); n != 4 {
+		t.Errorf("Expected 4 model calls, got %d", n)
+	}
+	if got := c.CacheStats(); got.Hits != 2 || got.Entries != 2 {
+		t.Errorf("Expected 2 hits and 2 entries, got %+v", got)
+	}
+
+	bypass := translator.WithMemoryPolicy(translator.MemoryBypass)
+	service := translator.NewService(c)
+	if _, _, err := service.Translate(ctx, strings.NewReader("<p>One</p>"), "en", "es", bypass); err != nil {
+		t.Fatal(err)
+	}
+	if n := llm.calls.Load(); n != 5 {
+		t.Errorf("Expected bypass to call the model, got %d calls", n)
+	}
+}
+
+func TestClient_Hints(t *testing.T) {
+	llm := &blockingLLM{release: make(chan struct{})}
+	close(llm.release)
+	c := NewClient(llm, DefaultCacheSize)
+
+	glossary := prompt.WithHints(context.Background(), prompt.Hints{
+		Glossary: []prompt.Term{{Source: "Heat index", Target: "Índice de calor"}},
+	})
+	for _, ctx := range []context.Context{context.Background(), glossary, glossary, context.Background()} {
+		if _, err := c.TranslateText(ctx, "High heat index", "en", "es"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A request with glossary terms does not take the translation made
+	// without them.
+	if n := llm.calls.Load(); n != 2 {
+		t.Errorf("Expected 2 model calls, got %d", n)
+	}
+	if got := c.CacheStats(); got.Hits != 2 || got.Entries != 2 {
+		t.Errorf("Expected 2 hits and 2 entries, got %+v", got)
+	}
+}
+
+func TestClient_CallerGivesUp(t *testing.T) {
+	llm := &blockingLLM{release: make(chan struct{})}
+	c := NewClient(llm, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.TranslateText(ctx, "Hello", "en", "es")
+		first <- err
+	}()
+	waitFor(t, func() bool { return llm.calls.Load() == 1 })
+
+	second := make(chan string)
+	go func() {
+		translated, err := c.TranslateText(context.Background(), "Hello", "en", "es")
+		if err != nil {
+			t.Error(err)
+		}
+		second <- translated
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The waiting request makes the call itself.
+	waitFor(t, func() bool { return llm.calls.Load() == 2 })
+	close(llm.release)
+	if got := <-second; got != "es:Hello" {
+		t.Errorf("Expected %q, got %q", "es:Hello", got)
+	}
+}
+
+// refusingBatchLLM refuses the texts of batches but translates texts sent
+// on their own.
+type refusingBatchLLM struct {
+	calls atomic.Int64
+}
+
+func (m *refusingBatchLLM) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	m.calls.Add(1)
+	return targetLang + ":" + text, nil
+}
+
+func (m *refusingBatchLLM) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	m.calls.Add(1)
+	refused := make([]string, len(texts))
+	for i, text := range texts {
+		refused[i] = "I cannot translate \"" + text + "\"."
+	}
+	return refused, nil
+}
+
+func (m *refusingBatchLLM) BatchTokenBudget() int {
+	return 1000
+}
+
+func (m *refusingBatchLLM) GetModelName() string {
+	return "test-model"
+}
+
+func TestClient_BatchRejected(t *testing.T) {
+	llm := &refusingBatchLLM{}
+	c := NewClient(llm, DefaultCacheSize)
+	service := translator.NewService(c, translator.WithBatching(0))
+
+	// The refused batch is not cached: each segment is translated again on
+	// its own by the model.
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader("<p>Alpha</p><p>Beta</p>"), "en", "es", translator.WithFragment("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>es:Alpha</p><p>es:Beta</p>"; translated != want || metadata.Rejected != 0 {
+		t.Errorf("Expected %q with no rejections, got %q (%d rejected)", want, translated, metadata.Rejected)
+	}
+	if n := llm.calls.Load(); n != 3 {
+		t.Errorf("Expected 3 model calls, got %d", n)
+	}
+	if got := c.CacheStats(); got.Hits != 0 || got.Entries != 2 {
+		t.Errorf("Expected no hits and the 2 accepted translations cached, got %+v", got)
+	}
+}
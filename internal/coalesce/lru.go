@@ -0,0 +1,66 @@
+package coalesce
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru holds the most recently used translations, up to a fixed number.
+// It is safe for concurrent use.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *lruEntry, most recently used first
+	items map[key]*list.Element
+}
+
+type lruEntry struct {
+	k           key
+	translation string
+}
+
+// newLRU returns an lru holding up to size translations. A size of 0 or
+// less holds none.
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[key]*list.Element)}
+}
+
+// get returns the translation held for k, marking it as used.
+func (c *lru) get(k key) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[k]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).translation, true
+}
+
+// add holds translation for k, evicting the least recently used
+// translation if the lru is full.
+func (c *lru) add(k key, translation string) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[k]; ok {
+		e.Value.(*lruEntry).translation = translation
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[k] = c.order.PushFront(&lruEntry{k: k, translation: translation})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).k)
+	}
+}
+
+// len returns the number of translations held.
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
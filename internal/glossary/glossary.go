@@ -0,0 +1,261 @@
+// Package glossary holds mandated translations of terms, per language pair,
+// for the translator to give the model and check its translations against.
+// Glossaries are loaded from CSV or TBX files and can be changed at run
+// time.
+package glossary
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+)
+
+// Term is the mandated translation of a term from one language into
+// another.
+type Term struct {
+	// SourceLang and TargetLang are BCP 47 tags, e.g. "en" and "pt-BR".
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+	Source     string `json:"source"`
+	// Target is the translation of Source. A term whose Target is its
+	// Source must not be translated.
+	Target string `json:"target"`
+}
+
+// pair is a language pair, by canonical tags.
+type pair struct {
+	source, target string
+}
+
+// Glossary holds terms by language pair. It is safe for concurrent use.
+type Glossary struct {
+	mu sync.RWMutex
+	// terms holds the terms of each pair by their lowercased source.
+	terms map[pair]map[string]Term
+}
+
+// New returns an empty Glossary.
+func New() *Glossary {
+	return &Glossary{terms: make(map[pair]map[string]Term)}
+}
+
+// Add adds t, replacing the term with the same source, in any case, for its
+// language pair. An empty Target means the term must not be translated.
+func (g *Glossary) Add(t Term) error {
+	t, err := normalize(t)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.add(t)
+	return nil
+}
+
+// add adds the normalized term t. g.mu must be held.
+func (g *Glossary) add(t Term) {
+	p := pair{t.SourceLang, t.TargetLang}
+	if g.terms[p] == nil {
+		g.terms[p] = make(map[string]Term)
+	}
+	g.terms[p][strings.ToLower(t.Source)] = t
+}
+
+// normalize returns t with canonical language tags and trimmed text, and
+// its Source as Target if it has none.
+func normalize(t Term) (Term, error) {
+	var err error
+	if t.SourceLang, err = lang.Canonicalize(t.SourceLang); err != nil {
+		return Term{}, fmt.Errorf("invalid source language: %w", err)
+	}
+	if t.TargetLang, err = lang.Canonicalize(t.TargetLang); err != nil {
+		return Term{}, fmt.Errorf("invalid target language: %w", err)
+	}
+	t.Source = strings.TrimSpace(t.Source)
+	t.Target = strings.TrimSpace(t.Target)
+	if t.Source == "" {
+		return Term{}, errors.New("term without source text")
+	}
+	if t.Target == "" {
+		t.Target = t.Source
+	}
+	return t, nil
+}
+
+// Remove removes the term with source, in any case, from the language
+// pair, and reports whether there was one.
+func (g *Glossary) Remove(sourceLang, targetLang, source string) bool {
+	p, ok := canonicalPair(sourceLang, targetLang)
+	if !ok {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := strings.ToLower(strings.TrimSpace(source))
+	if _, ok := g.terms[p][key]; !ok {
+		return false
+	}
+	delete(g.terms[p], key)
+	if len(g.terms[p]) == 0 {
+		delete(g.terms, p)
+	}
+	return true
+}
+
+// List returns the terms of the language pair, or of all pairs if both
+// languages are empty, sorted by pair and source.
+func (g *Glossary) List(sourceLang, targetLang string) []Term {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var list []Term
+	if sourceLang == "" && targetLang == "" {
+		for _, terms := range g.terms {
+			for _, t := range terms {
+				list = append(list, t)
+			}
+		}
+	} else if p, ok := canonicalPair(sourceLang, targetLang); ok {
+		for _, t := range g.terms[p] {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool {
+		x, y := list[a], list[b]
+		if x.SourceLang != y.SourceLang {
+			return x.SourceLang < y.SourceLang
+		}
+		if x.TargetLang != y.TargetLang {
+			return x.TargetLang < y.TargetLang
+		}
+		return x.Source < y.Source
+	})
+	return list
+}
+
+// Match returns the terms of the language pair occurring in text as whole
+// words, in any case, in order of appearance. Occurrences within a longer
+// term, such as "Weather" in "National Weather Service", do not count.
+// Terms of the pair of primary languages apply too, e.g. those for "en" to
+// "pt" when translating from "en-US" to "pt-BR", unless the exact pair has
+// the same term.
+func (g *Glossary) Match(text, sourceLang, targetLang string) []prompt.Term {
+	p, ok := canonicalPair(sourceLang, targetLang)
+	if !ok {
+		return nil
+	}
+	pairs := []pair{p}
+	if primary := (pair{lang.Primary(p.source), lang.Primary(p.target)}); primary != p {
+		pairs = append(pairs, primary)
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	lower := strings.ToLower(text)
+	type match struct {
+		term  Term
+		spans [][2]int
+	}
+	var candidates []match
+	seen := make(map[string]bool)
+	for _, p := range pairs {
+		for key, t := range g.terms[p] {
+			if seen[key] {
+				continue
+			}
+			if spans := wordSpans(lower, key); spans != nil {
+				seen[key] = true
+				candidates = append(candidates, match{t, spans})
+			}
+		}
+	}
+	// Longer terms claim their occurrences first.
+	sort.Slice(candidates, func(a, b int) bool {
+		x, y := candidates[a].term.Source, candidates[b].term.Source
+		if len(x) != len(y) {
+			return len(x) > len(y)
+		}
+		return x < y
+	})
+	var claimed [][2]int
+	within := func(span [2]int) bool {
+		for _, c := range claimed {
+			if span[0] >= c[0] && span[1] <= c[1] {
+				return true
+			}
+		}
+		return false
+	}
+	type found struct {
+		term prompt.Term
+		pos  int
+	}
+	var matches []found
+	for _, c := range candidates {
+		pos := -1
+		var free [][2]int
+		for _, span := range c.spans {
+			if !within(span) {
+				free = append(free, span)
+				if pos < 0 {
+					pos = span[0]
+				}
+			}
+		}
+		if pos >= 0 {
+			claimed = append(claimed, free...)
+			matches = append(matches, found{prompt.Term{Source: c.term.Source, Target: c.term.Target}, pos})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].pos < matches[b].pos })
+	var terms []prompt.Term
+	for _, m := range matches {
+		terms = append(terms, m.term)
+	}
+	return terms
+}
+
+// canonicalPair returns the language pair of two tags.
+func canonicalPair(sourceLang, targetLang string) (pair, bool) {
+	source, err := lang.Canonicalize(sourceLang)
+	if err != nil {
+		return pair{}, false
+	}
+	target, err := lang.Canonicalize(targetLang)
+	if err != nil {
+		return pair{}, false
+	}
+	return pair{source, target}, true
+}
+
+// wordSpans returns the start and end of the occurrences of word in s that
+// are not part of a longer word.
+func wordSpans(s, word string) [][2]int {
+	var spans [][2]int
+	for from := 0; from < len(s); {
+		i := strings.Index(s[from:], word)
+		if i < 0 {
+			break
+		}
+		start, end := from+i, from+i+len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(s) || !isWordRune(after)) {
+			spans = append(spans, [2]int{start, end})
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		from = start + size
+	}
+	return spans
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
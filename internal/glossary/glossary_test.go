@@ -0,0 +1,107 @@
+package glossary
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+)
+
+func newGlossary(t *testing.T, terms ...Term) *Glossary {
+	t.Helper()
+	g := New()
+	for _, term := range terms {
+		if err := g.Add(term); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+func TestMatch(t *testing.T) {
+	g := newGlossary(t,
+		Term{"en", "es", "National Weather Service", "Servicio Nacional de Meteorología"},
+		Term{"en", "es", "Heat index", "Índice de calor"},
+		Term{"en", "es", "heat", "calor"},
+		Term{"en", "es", "weather", "tiempo"},
+		Term{"en", "es", "NOAA", ""},
+		Term{"en", "pt", "Heat index", "Índice de calor"},
+	)
+	tests := []struct {
+		text string
+		want []prompt.Term
+	}{
+		{"The HEAT INDEX tops 105, says the National Weather Service.", []prompt.Term{
+			{Source: "Heat index", Target: "Índice de calor"},
+			{Source: "National Weather Service", Target: "Servicio Nacional de Meteorología"},
+		}},
+		// Terms within longer ones count where they occur on their own.
+		{"Heat index and heat: National Weather Service weather", []prompt.Term{
+			{Source: "Heat index", Target: "Índice de calor"},
+			{Source: "heat", Target: "calor"},
+			{Source: "National Weather Service", Target: "Servicio Nacional de Meteorología"},
+			{Source: "weather", Target: "tiempo"},
+		}},
+		{"NOAA radar", []prompt.Term{{Source: "NOAA", Target: "NOAA"}}},
+		// Only whole words match.
+		{"Heated debate at NOAAs office", nil},
+		{"Clear skies", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := g.Match(tt.text, "en", "es"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatch_PrimaryLanguages(t *testing.T) {
+	g := newGlossary(t,
+		Term{"en", "pt", "Red Flag Warning", "Alerta de Bandeira Vermelha"},
+		Term{"en", "pt", "Heat index", "Índice de calor"},
+		Term{"en-US", "pt-BR", "Heat index", "Sensação térmica"},
+	)
+	want := []prompt.Term{
+		{Source: "Red Flag Warning", Target: "Alerta de Bandeira Vermelha"},
+		{Source: "Heat index", Target: "Sensação térmica"},
+	}
+	if got := g.Match("Red Flag Warning; heat index 110", "en-us", "pt-BR"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	want = []prompt.Term{{Source: "Heat index", Target: "Índice de calor"}}
+	if got := g.Match("heat index", "en", "pt-BR"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestAddRemoveList(t *testing.T) {
+	g := newGlossary(t,
+		Term{"en", "fr", "Heat index", "Indice de chaleur"},
+		Term{"EN", "es", " Heat Index ", "Índice de calor"},
+		Term{"en", "es", "heat index", "Índice de calor"},
+	)
+	if err := g.Add(Term{"en", "es", " ", "x"}); err == nil {
+		t.Error("Expected an error for a term without source")
+	}
+	if err := g.Add(Term{"english", "es", "Heat", "Calor"}); err == nil {
+		t.Error("Expected an error for an invalid language")
+	}
+
+	want := []Term{
+		{"en", "es", "heat index", "Índice de calor"},
+		{"en", "fr", "Heat index", "Indice de chaleur"},
+	}
+	if got := g.List("", ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := g.List("en", "fr"); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("Expected %v, got %v", want[1:], got)
+	}
+	if !g.Remove("en", "es", "HEAT INDEX") || g.Remove("en", "es", "heat index") {
+		t.Error("Expected the term removed once")
+	}
+	if got := g.List("", ""); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("Expected %v, got %v", want[1:], got)
+	}
+}
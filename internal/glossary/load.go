@@ -0,0 +1,207 @@
+package glossary
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is the file format of a glossary.
+type Format string
+
+const (
+	// CSV is a table with a header row naming the columns source_lang,
+	// target_lang, source and target, in any order. Other columns are
+	// ignored. An empty target means the term must not be translated.
+	CSV Format = "csv"
+	// TBX is a TermBase eXchange document. Each concept entry gives a term
+	// for each language pair of its languages, using the first term of each
+	// language.
+	TBX Format = "tbx"
+)
+
+// ParseFormat returns the Format named by s.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case CSV, TBX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown glossary format %q (expected csv or tbx)", s)
+}
+
+// LoadFile adds the terms of the glossary file at path, in the format given
+// by its extension, and returns their number.
+func (g *Glossary) LoadFile(path string) (int, error) {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := g.Load(f, format)
+	if err != nil {
+		return n, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+// Load adds the terms read from r in format and returns their number. If
+// any term is invalid, none are added.
+func (g *Glossary) Load(r io.Reader, format Format) (int, error) {
+	var terms []Term
+	var err error
+	switch format {
+	case CSV:
+		terms, err = ReadCSV(r)
+	case TBX:
+		terms, err = ReadTBX(r)
+	default:
+		err = fmt.Errorf("unknown glossary format %q", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range terms {
+		if terms[i], err = normalize(t); err != nil {
+			return 0, fmt.Errorf("term %q: %w", t.Source, err)
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, t := range terms {
+		g.add(t)
+	}
+	return len(terms), nil
+}
+
+// ReadCSV returns the terms of a CSV glossary.
+func ReadCSV(r io.Reader) ([]Term, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{"source_lang": -1, "target_lang": -1, "source": -1, "target": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+	for name, i := range columns {
+		if i < 0 && name != "target" {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i := columns[name]; i >= 0 && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var terms []Term
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return terms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if field(record, "source") == "" {
+			continue
+		}
+		terms = append(terms, Term{
+			SourceLang: field(record, "source_lang"),
+			TargetLang: field(record, "target_lang"),
+			Source:     field(record, "source"),
+			Target:     field(record, "target"),
+		})
+	}
+}
+
+// WriteCSV writes terms as a CSV glossary.
+func WriteCSV(w io.Writer, terms []Term) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"source_lang", "target_lang", "source", "target"})
+	for _, t := range terms {
+		cw.Write([]string{t.SourceLang, t.TargetLang, t.Source, t.Target})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tbxDocument is the part of a TBX document holding terms: TBX 2 documents
+// have termEntry elements with a tig or ntig per term, TBX 3 documents
+// conceptEntry elements with a termSec per term.
+type tbxDocument struct {
+	Entries []tbxEntry `xml:"text>body>termEntry"`
+	// Concepts are the entries of TBX 3 documents.
+	Concepts []tbxEntry `xml:"text>body>conceptEntry"`
+}
+
+type tbxEntry struct {
+	LangSets []tbxLangSet `xml:"langSet"`
+	// LangSecs are the language sections of TBX 3 documents.
+	LangSecs []tbxLangSet `xml:"langSec"`
+}
+
+type tbxLangSet struct {
+	Lang     string   `xml:"lang,attr"`
+	Terms    []string `xml:"tig>term"`
+	NTerms   []string `xml:"ntig>termGrp>term"`
+	SecTerms []string `xml:"termSec>term"`
+}
+
+// ReadTBX returns the terms of a TBX glossary.
+func ReadTBX(r io.Reader) ([]Term, error) {
+	var doc tbxDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	entries := append(doc.Entries, doc.Concepts...)
+	if len(entries) == 0 {
+		return nil, errors.New("no term entries")
+	}
+
+	var terms []Term
+	for _, e := range entries {
+		type langTerm struct{ lang, term string }
+		var langs []langTerm
+		for _, ls := range append(e.LangSets, e.LangSecs...) {
+			all := append(append(ls.Terms, ls.NTerms...), ls.SecTerms...)
+			if ls.Lang == "" || len(all) == 0 || strings.TrimSpace(all[0]) == "" {
+				continue
+			}
+			langs = append(langs, langTerm{ls.Lang, strings.TrimSpace(all[0])})
+		}
+		for _, source := range langs {
+			for _, target := range langs {
+				if source.lang == target.lang {
+					continue
+				}
+				terms = append(terms, Term{
+					SourceLang: source.lang,
+					TargetLang: target.lang,
+					Source:     source.term,
+					Target:     target.term,
+				})
+			}
+		}
+	}
+	return terms, nil
+}
@@ -0,0 +1,110 @@
+package glossary
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	input := "\ufeffSource,Target,Source_Lang,Target_Lang,Note\n" +
+		"National Weather Service,Servicio Nacional de Meteorología,en,es,agency\n" +
+		"\"Heat index\",\"Índice de calor\",en,es\n" +
+		"NOAA,,en,es,never translated\n" +
+		",,,\n"
+	terms, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Term{
+		{"en", "es", "National Weather Service", "Servicio Nacional de Meteorología"},
+		{"en", "es", "Heat index", "Índice de calor"},
+		{"en", "es", "NOAA", ""},
+	}
+	if !reflect.DeepEqual(terms, want) {
+		t.Errorf("Expected %v, got %v", want, terms)
+	}
+
+	if _, err := ReadCSV(strings.NewReader("source,target\nHeat,Calor\n")); err == nil {
+		t.Error("Expected an error for missing language columns")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	g := newGlossary(t,
+		Term{"en", "es", "Heat index", "Índice de calor"},
+		Term{"en", "es", "NOAA", ""},
+	)
+	var b strings.Builder
+	if err := WriteCSV(&b, g.List("", "")); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := New()
+	if _, err := reloaded.Load(strings.NewReader(b.String()), CSV); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.List("", ""), g.List("", "")) {
+		t.Errorf("Expected the glossary to round-trip, got %q", b.String())
+	}
+}
+
+func TestReadTBX(t *testing.T) {
+	tests := []struct {
+		name, input string
+	}{
+		{"TBX 2", `<?xml version="1.0"?>
+<martif type="TBX" xml:lang="en">
+  <text><body>
+    <termEntry id="c1">
+      <descrip type="subjectField">Weather</descrip>
+      <langSet xml:lang="en"><tig><term>Red Flag Warning</term></tig></langSet>
+      <langSet xml:lang="es"><ntig><termGrp><term>Aviso de Bandera Roja</term></termGrp></ntig></langSet>
+    </termEntry>
+  </body></text>
+</martif>`},
+		{"TBX 3", `<?xml version="1.0"?>
+<tbx type="TBX-Basic" style="dca" xml:lang="en" xmlns="urn:iso:std:iso:30042:ed-2">
+  <text><body>
+    <conceptEntry id="c1">
+      <langSec xml:lang="en"><termSec><term>Red Flag Warning</term></termSec></langSec>
+      <langSec xml:lang="es">
+        <termSec><term>Aviso de Bandera Roja</term></termSec>
+        <termSec><term>Alerta de Bandera Roja</term></termSec>
+      </langSec>
+    </conceptEntry>
+  </body></text>
+</tbx>`},
+	}
+	want := []Term{
+		{"en", "es", "Red Flag Warning", "Aviso de Bandera Roja"},
+		{"es", "en", "Aviso de Bandera Roja", "Red Flag Warning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms, err := ReadTBX(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(terms, want) {
+				t.Errorf("Expected %v, got %v", want, terms)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "terms.csv")
+	if err := os.WriteFile(path, []byte("source_lang,target_lang,source,target\nen,es,Heat index,Índice de calor\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g := New()
+	if n, err := g.LoadFile(path); err != nil || n != 1 {
+		t.Fatalf("Expected 1 term, got %d (%v)", n, err)
+	}
+	if _, err := g.LoadFile(filepath.Join(dir, "terms.txt")); err == nil {
+		t.Error("Expected an error for an unknown extension")
+	}
+}
@@ -0,0 +1,189 @@
+package lang
+
+// base describes a primary language subtag.
+type base struct {
+	name   string
+	native string
+	// script is the script the language is written in by default.
+	script string
+	// showScript names the script even when the tag does not, for
+	// languages commonly written in more than one.
+	showScript bool
+}
+
+// languages maps primary language subtags to their descriptions.
+var languages = map[string]base{
+	"af":  {name: "Afrikaans", native: "Afrikaans", script: "Latn"},
+	"am":  {name: "Amharic", native: "አማርኛ", script: "Ethi"},
+	"ar":  {name: "Arabic", native: "العربية", script: "Arab"},
+	"az":  {name: "Azerbaijani", native: "azərbaycan", script: "Latn"},
+	"be":  {name: "Belarusian", native: "беларуская", script: "Cyrl"},
+	"bg":  {name: "Bulgarian", native: "български", script: "Cyrl"},
+	"bn":  {name: "Bengali", native: "বাংলা", script: "Beng"},
+	"bs":  {name: "Bosnian", native: "bosanski", script: "Latn"},
+	"ca":  {name: "Catalan", native: "català", script: "Latn"},
+	"ckb": {name: "Central Kurdish", native: "کوردیی ناوەندی", script: "Arab"},
+	"cs":  {name: "Czech", native: "čeština", script: "Latn"},
+	"cy":  {name: "Welsh", native: "Cymraeg", script: "Latn"},
+	"da":  {name: "Danish", native: "dansk", script: "Latn"},
+	"de":  {name: "German", native: "Deutsch", script: "Latn"},
+	"dv":  {name: "Divehi", native: "ދިވެހި", script: "Thaa"},
+	"el":  {name: "Greek", native: "Ελληνικά", script: "Grek"},
+	"en":  {name: "English", native: "English", script: "Latn"},
+	"eo":  {name: "Esperanto", native: "esperanto", script: "Latn"},
+	"es":  {name: "Spanish", native: "español", script: "Latn"},
+	"et":  {name: "Estonian", native: "eesti", script: "Latn"},
+	"eu":  {name: "Basque", native: "euskara", script: "Latn"},
+	"fa":  {name: "Persian", native: "فارسی", script: "Arab"},
+	"fi":  {name: "Finnish", native: "suomi", script: "Latn"},
+	"fil": {name: "Filipino", native: "Filipino", script: "Latn"},
+	"fr":  {name: "French", native: "français", script: "Latn"},
+	"ga":  {name: "Irish", native: "Gaeilge", script: "Latn"},
+	"gl":  {name: "Galician", native: "galego", script: "Latn"},
+	"gu":  {name: "Gujarati", native: "ગુજરાતી", script: "Gujr"},
+	"ha":  {name: "Hausa", native: "Hausa", script: "Latn"},
+	"he":  {name: "Hebrew", native: "עברית", script: "Hebr"},
+	"hi":  {name: "Hindi", native: "हिन्दी", script: "Deva"},
+	"hr":  {name: "Croatian", native: "hrvatski", script: "Latn"},
+	"ht":  {name: "Haitian Creole", native: "kreyòl ayisyen", script: "Latn"},
+	"hu":  {name: "Hungarian", native: "magyar", script: "Latn"},
+	"hy":  {name: "Armenian", native: "հայերեն", script: "Armn"},
+	"id":  {name: "Indonesian", native: "Indonesia", script: "Latn"},
+	"ig":  {name: "Igbo", native: "Igbo", script: "Latn"},
+	"is":  {name: "Icelandic", native: "íslenska", script: "Latn"},
+	"it":  {name: "Italian", native: "italiano", script: "Latn"},
+	"iw":  {name: "Hebrew", native: "עברית", script: "Hebr"},
+	"ja":  {name: "Japanese", native: "日本語", script: "Jpan"},
+	"ka":  {name: "Georgian", native: "ქართული", script: "Geor"},
+	"kk":  {name: "Kazakh", native: "қазақ тілі", script: "Cyrl"},
+	"km":  {name: "Khmer", native: "ខ្មែរ", script: "Khmr"},
+	"kn":  {name: "Kannada", native: "ಕನ್ನಡ", script: "Knda"},
+	"ko":  {name: "Korean", native: "한국어", script: "Kore"},
+	"ks":  {name: "Kashmiri", native: "کٲشُر", script: "Arab"},
+	"ku":  {name: "Kurdish", native: "kurdî", script: "Latn"},
+	"ky":  {name: "Kyrgyz", native: "кыргызча", script: "Cyrl"},
+	"lo":  {name: "Lao", native: "ລາວ", script: "Laoo"},
+	"lt":  {name: "Lithuanian", native: "lietuvių", script: "Latn"},
+	"lv":  {name: "Latvian", native: "latviešu", script: "Latn"},
+	"mk":  {name: "Macedonian", native: "македонски", script: "Cyrl"},
+	"ml":  {name: "Malayalam", native: "മലയാളം", script: "Mlym"},
+	"mn":  {name: "Mongolian", native: "монгол", script: "Cyrl"},
+	"mr":  {name: "Marathi", native: "मराठी", script: "Deva"},
+	"ms":  {name: "Malay", native: "Melayu", script: "Latn"},
+	"mt":  {name: "Maltese", native: "Malti", script: "Latn"},
+	"my":  {name: "Burmese", native: "မြန်မာ", script: "Mymr"},
+	"nb":  {name: "Norwegian Bokmål", native: "norsk bokmål", script: "Latn"},
+	"ne":  {name: "Nepali", native: "नेपाली", script: "Deva"},
+	"nl":  {name: "Dutch", native: "Nederlands", script: "Latn"},
+	"nn":  {name: "Norwegian Nynorsk", native: "norsk nynorsk", script: "Latn"},
+	"no":  {name: "Norwegian", native: "norsk", script: "Latn"},
+	"pa":  {name: "Punjabi", native: "ਪੰਜਾਬੀ", script: "Guru"},
+	"pl":  {name: "Polish", native: "polski", script: "Latn"},
+	"ps":  {name: "Pashto", native: "پښتو", script: "Arab"},
+	"pt":  {name: "Portuguese", native: "português", script: "Latn"},
+	"ro":  {name: "Romanian", native: "română", script: "Latn"},
+	"ru":  {name: "Russian", native: "русский", script: "Cyrl"},
+	"sd":  {name: "Sindhi", native: "سنڌي", script: "Arab"},
+	"si":  {name: "Sinhala", native: "සිංහල", script: "Sinh"},
+	"sk":  {name: "Slovak", native: "slovenčina", script: "Latn"},
+	"sl":  {name: "Slovenian", native: "slovenščina", script: "Latn"},
+	"so":  {name: "Somali", native: "Soomaali", script: "Latn"},
+	"sq":  {name: "Albanian", native: "shqip", script: "Latn"},
+	"sr":  {name: "Serbian", native: "српски", script: "Cyrl", showScript: true},
+	"sv":  {name: "Swedish", native: "svenska", script: "Latn"},
+	"sw":  {name: "Swahili", native: "Kiswahili", script: "Latn"},
+	"syr": {name: "Syriac", native: "ܣܘܪܝܝܐ", script: "Syrc"},
+	"ta":  {name: "Tamil", native: "தமிழ்", script: "Taml"},
+	"te":  {name: "Telugu", native: "తెలుగు", script: "Telu"},
+	"th":  {name: "Thai", native: "ไทย", script: "Thai"},
+	"tl":  {name: "Tagalog", native: "Tagalog", script: "Latn"},
+	"tr":  {name: "Turkish", native: "Türkçe", script: "Latn"},
+	"ug":  {name: "Uyghur", native: "ئۇيغۇرچە", script: "Arab"},
+	"uk":  {name: "Ukrainian", native: "українська", script: "Cyrl"},
+	"ur":  {name: "Urdu", native: "اردو", script: "Arab"},
+	"uz":  {name: "Uzbek", native: "o‘zbek", script: "Latn"},
+	"vi":  {name: "Vietnamese", native: "Tiếng Việt", script: "Latn"},
+	"yi":  {name: "Yiddish", native: "ייִדיש", script: "Hebr"},
+	"yo":  {name: "Yoruba", native: "Èdè Yorùbá", script: "Latn"},
+	"zh":  {name: "Chinese", native: "中文", script: "Hans", showScript: true},
+	"zu":  {name: "Zulu", native: "isiZulu", script: "Latn"},
+}
+
+// regionScripts gives the script implied by a language and region where
+// it differs from the language's default.
+var regionScripts = map[string]string{
+	"zh-TW": "Hant",
+	"zh-HK": "Hant",
+	"zh-MO": "Hant",
+}
+
+// nativeNames overrides the native name of a language in a script.
+var nativeNames = map[string]string{
+	"zh-Hans": "简体中文",
+	"zh-Hant": "繁體中文",
+	"sr-Latn": "srpski",
+	"az-Arab": "آذربایجان دیلی",
+	"ku-Arab": "کوردی",
+	"pa-Arab": "پنجابی",
+}
+
+// rtlScripts are the scripts written right to left.
+var rtlScripts = map[string]bool{
+	"Adlm": true, "Arab": true, "Hebr": true, "Nkoo": true, "Rohg": true,
+	"Syrc": true, "Thaa": true,
+}
+
+// scriptNames are the names of scripts used to qualify language names.
+var scriptNames = map[string]string{
+	"Arab": "Arabic",
+	"Cyrl": "Cyrillic",
+	"Deva": "Devanagari",
+	"Hans": "Simplified",
+	"Hant": "Traditional",
+	"Hebr": "Hebrew",
+	"Latn": "Latin",
+}
+
+// regionNames are the names of regions used to qualify language names.
+var regionNames = map[string]string{
+	"001": "World",
+	"419": "Latin America",
+	"AR":  "Argentina",
+	"AT":  "Austria",
+	"AU":  "Australia",
+	"BE":  "Belgium",
+	"BR":  "Brazil",
+	"CA":  "Canada",
+	"CH":  "Switzerland",
+	"CL":  "Chile",
+	"CN":  "China",
+	"CO":  "Colombia",
+	"DE":  "Germany",
+	"EG":  "Egypt",
+	"ES":  "Spain",
+	"FR":  "France",
+	"GB":  "United Kingdom",
+	"HK":  "Hong Kong",
+	"IE":  "Ireland",
+	"IN":  "India",
+	"IR":  "Iran",
+	"IT":  "Italy",
+	"JP":  "Japan",
+	"KR":  "South Korea",
+	"MA":  "Morocco",
+	"MO":  "Macao",
+	"MX":  "Mexico",
+	"NL":  "Netherlands",
+	"NZ":  "New Zealand",
+	"PE":  "Peru",
+	"PK":  "Pakistan",
+	"PT":  "Portugal",
+	"RU":  "Russia",
+	"SA":  "Saudi Arabia",
+	"SG":  "Singapore",
+	"TW":  "Taiwan",
+	"UA":  "Ukraine",
+	"US":  "United States",
+	"VE":  "Venezuela",
+	"ZA":  "South Africa",
+}
@@ -0,0 +1,195 @@
+// Package lang is a registry of the languages the service translates
+// between: it validates and canonicalizes BCP 47 language tags and maps them
+// to English and native names, script and writing direction.
+package lang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Language describes a language tag.
+type Language struct {
+	// Tag is the canonical form of the tag, e.g. "pt-BR" or "zh-Hant".
+	Tag string
+	// Name is the English name, qualified by script and region where the
+	// tag has them, e.g. "Portuguese (Brazil)" or "Chinese (Traditional)".
+	Name string
+	// NativeName is the name of the language in itself.
+	NativeName string
+	// Script is the ISO 15924 code of the script, e.g. "Latn".
+	Script string
+	// RTL is set for languages written right to left.
+	RTL bool
+}
+
+// Lookup validates tag and returns the language it names. Subtags may be
+// separated by "-" or "_" and are matched case-insensitively.
+func Lookup(tag string) (Language, error) {
+	t, err := parse(tag)
+	if err != nil {
+		return Language{}, err
+	}
+	b, ok := languages[t.language]
+	if !ok {
+		return Language{}, fmt.Errorf("unsupported language %q", tag)
+	}
+
+	script := t.script
+	if script == "" {
+		script = b.script
+		if s, ok := regionScripts[t.language+"-"+t.region]; ok {
+			script = s
+		}
+	}
+	var qualifiers []string
+	if t.script != "" && t.script != b.script || b.showScript {
+		name, ok := scriptNames[script]
+		if !ok {
+			name = script
+		}
+		qualifiers = append(qualifiers, name)
+	}
+	if t.region != "" {
+		name, ok := regionNames[t.region]
+		if !ok {
+			name = t.region
+		}
+		qualifiers = append(qualifiers, name)
+	}
+
+	name := b.name
+	if len(qualifiers) > 0 {
+		name += " (" + strings.Join(qualifiers, ", ") + ")"
+	}
+	native := b.native
+	if n, ok := nativeNames[t.language+"-"+script]; ok {
+		native = n
+	}
+	return Language{
+		Tag:        t.String(),
+		Name:       name,
+		NativeName: native,
+		Script:     script,
+		RTL:        rtlScripts[script],
+	}, nil
+}
+
+// Canonicalize returns the canonical form of a supported tag.
+func Canonicalize(tag string) (string, error) {
+	l, err := Lookup(tag)
+	if err != nil {
+		return "", err
+	}
+	return l.Tag, nil
+}
+
+// Name returns the English name of the language tag names, or tag itself
+// if it is not in the registry.
+func Name(tag string) string {
+	if l, err := Lookup(tag); err == nil {
+		return l.Name
+	}
+	return tag
+}
+
+// Primary returns the lowercased primary language subtag of tag, e.g. "pt"
+// for "pt-BR".
+func Primary(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// IsRTL reports whether text in the language tag is written right to left.
+// Tags outside the registry are right to left only if they name a
+// right-to-left script.
+func IsRTL(tag string) bool {
+	if l, err := Lookup(tag); err == nil {
+		return l.RTL
+	}
+	t, err := parse(tag)
+	return err == nil && rtlScripts[t.script]
+}
+
+// tag is a parsed language tag.
+type tag struct {
+	language string
+	script   string
+	region   string
+	// rest holds the variant and extension subtags.
+	rest []string
+}
+
+// parse splits a BCP 47 tag into its subtags and normalizes their case.
+func parse(s string) (tag, error) {
+	subtags := strings.FieldsFunc(strings.TrimSpace(s), func(r rune) bool { return r == '-' || r == '_' })
+	if len(subtags) == 0 {
+		return tag{}, fmt.Errorf("empty language tag")
+	}
+	for _, st := range subtags {
+		if len(st) > 8 || !isAlphanumeric(st) {
+			return tag{}, fmt.Errorf("invalid language tag %q", s)
+		}
+	}
+
+	var t tag
+	t.language = strings.ToLower(subtags[0])
+	if len(t.language) < 2 || len(t.language) > 3 || !isAlpha(t.language) {
+		return tag{}, fmt.Errorf("invalid language tag %q", s)
+	}
+	subtags = subtags[1:]
+	if len(subtags) > 0 && len(subtags[0]) == 4 && isAlpha(subtags[0]) {
+		t.script = strings.ToUpper(subtags[0][:1]) + strings.ToLower(subtags[0][1:])
+		subtags = subtags[1:]
+	}
+	if len(subtags) > 0 && (len(subtags[0]) == 2 && isAlpha(subtags[0]) || len(subtags[0]) == 3 && isDigits(subtags[0])) {
+		t.region = strings.ToUpper(subtags[0])
+		subtags = subtags[1:]
+	}
+	for _, st := range subtags {
+		t.rest = append(t.rest, strings.ToLower(st))
+	}
+	return t, nil
+}
+
+// String returns the canonical form of the tag.
+func (t tag) String() string {
+	parts := []string{t.language}
+	if t.script != "" {
+		parts = append(parts, t.script)
+	}
+	if t.region != "" {
+		parts = append(parts, t.region)
+	}
+	return strings.Join(append(parts, t.rest...), "-")
+}
+
+func isAlpha(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package lang
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		tag    string
+		want   Language
+		hasErr bool
+	}{
+		{tag: "en", want: Language{Tag: "en", Name: "English", NativeName: "English", Script: "Latn"}},
+		{tag: "PT_br", want: Language{Tag: "pt-BR", Name: "Portuguese (Brazil)", NativeName: "português", Script: "Latn"}},
+		{tag: "pt-PT", want: Language{Tag: "pt-PT", Name: "Portuguese (Portugal)", NativeName: "português", Script: "Latn"}},
+		{tag: "zh", want: Language{Tag: "zh", Name: "Chinese (Simplified)", NativeName: "简体中文", Script: "Hans"}},
+		{tag: "zh-TW", want: Language{Tag: "zh-TW", Name: "Chinese (Traditional, Taiwan)", NativeName: "繁體中文", Script: "Hant"}},
+		{tag: "zh-hant", want: Language{Tag: "zh-Hant", Name: "Chinese (Traditional)", NativeName: "繁體中文", Script: "Hant"}},
+		{tag: "sr-Latn", want: Language{Tag: "sr-Latn", Name: "Serbian (Latin)", NativeName: "srpski", Script: "Latn"}},
+		{tag: "es-419", want: Language{Tag: "es-419", Name: "Spanish (Latin America)", NativeName: "español", Script: "Latn"}},
+		{tag: "ar-EG", want: Language{Tag: "ar-EG", Name: "Arabic (Egypt)", NativeName: "العربية", Script: "Arab", RTL: true}},
+		{tag: "az-Arab", want: Language{Tag: "az-Arab", Name: "Azerbaijani (Arabic)", NativeName: "آذربایجان دیلی", Script: "Arab", RTL: true}},
+		{tag: "de-CH-1996", want: Language{Tag: "de-CH-1996", Name: "German (Switzerland)", NativeName: "Deutsch", Script: "Latn"}},
+		{tag: "", hasErr: true},
+		{tag: "english", hasErr: true},
+		{tag: "xx", hasErr: true},
+		{tag: "en-US-<script>", hasErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := Lookup(tt.tag)
+			if tt.hasErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsRTL(t *testing.T) {
+	tests := map[string]bool{
+		"ar":      true,
+		"ar-EG":   true,
+		"he":      true,
+		"fa_IR":   true,
+		"en":      false,
+		"ur":      true,
+		"az-Arab": true,
+		"ku-Latn": false,
+		"ks-Deva": false,
+		"xx-Hebr": true,
+		"xx":      false,
+		"":        false,
+	}
+	for tag, want := range tests {
+		if got := IsRTL(tag); got != want {
+			t.Errorf("IsRTL(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	if got := Name("ja"); got != "Japanese" {
+		t.Errorf("Expected Japanese, got %q", got)
+	}
+	if got := Name("tlh"); got != "tlh" {
+		t.Errorf("Expected an unknown tag to be returned as is, got %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// batchTokenBudgets lists, by model family, how many source tokens are packed
+// into one batch request. Small models follow long numbered lists less
+// reliably, so they get smaller batches. The first matching entry wins.
+var batchTokenBudgets = []struct {
+	family string
+	tokens int
+}{
+	{"translategemma", 256},
+	{"gemma", 512},
+	{"llama", 768},
+	{"mistral", 768},
+	{"qwen", 768},
+}
+
+// defaultBatchTokenBudget is the budget of models not listed above.
+const defaultBatchTokenBudget = 384
+
+// batchMarkerPattern matches the [[n]] markers that number the texts of a
+// batch, at the start of a line.
+var batchMarkerPattern = regexp.MustCompile(`(?m)^[ \t]*\[\[(\d+)\]\][ \t]*`)
+
+// BatchTokenBudget returns the number of source tokens packed into one
+// batch request for the client's model.
+func (c *Client) BatchTokenBudget() int {
+	model := strings.ToLower(c.model)
+	for _, b := range batchTokenBudgets {
+		if strings.Contains(model, b.family) {
+			return b.tokens
+		}
+	}
+	return defaultBatchTokenBudget
+}
+
+// TranslateBatch translates several texts with one request. In plain-text
+// mode the batch template numbers the texts with [[n]] markers, and the
+// response must repeat every marker, in order, before the translation of
+// the text.
+func (c *Client) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	if c.output == OutputJSON {
+		translations, err := c.translateBatchJSON(ctx, texts, sourceLang, targetLang)
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			return translations, err
+		}
+		// The server does not enforce the schema; fall back to plain text.
+	}
+
+	v := c.vars(ctx, sourceLang, targetLang, texts...)
+	system, err := c.template.System(v)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.template.Batch(v)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.generate(ctx, request{system: system, prompt: p, texts: texts})
+	if err != nil {
+		return nil, err
+	}
+	return splitBatch(response, len(texts))
+}
+
+// splitBatch splits a batch response into its n numbered translations.
+// Anything before the first marker, such as a preamble, is ignored.
+func splitBatch(response string, n int) ([]string, error) {
+	markers := batchMarkerPattern.FindAllStringSubmatchIndex(response, -1)
+	if len(markers) != n {
+		return nil, fmt.Errorf("batch response has %d numbered translations, want %d", len(markers), n)
+	}
+	translations := make([]string, n)
+	for i, m := range markers {
+		num, _ := strconv.Atoi(response[m[2]:m[3]])
+		if num != i+1 {
+			return nil, fmt.Errorf("batch response has translation [[%d]] in position %d", num, i+1)
+		}
+		end := len(response)
+		if i+1 < n {
+			end = markers[i+1][0]
+		}
+		translations[i] = strings.TrimSpace(response[m[1]:end])
+		if translations[i] == "" {
+			return nil, fmt.Errorf("batch response has an empty translation [[%d]]", num)
+		}
+	}
+	return translations, nil
+}
@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		n        int
+		expected []string
+		wantErr  bool
+	}{
+		{"plain", "[[1]] Hola\n[[2]] Mundo", 2, []string{"Hola", "Mundo"}, false},
+		{"preamble", "Here are the translations:\n\n[[1]] Hola\n\n[[2]] Haga <g1>clic</g1>\n", 2, []string{"Hola", "Haga <g1>clic</g1>"}, false},
+		{"multi-line", "[[1]] Uno\ndos\n[[2]] Tres", 2, []string{"Uno\ndos", "Tres"}, false},
+		{"marker inside text", "[[1]] Ver [[2]] abajo\n[[2]] Fin", 2, []string{"Ver [[2]] abajo", "Fin"}, false},
+		{"missing", "[[1]] Hola", 2, nil, true},
+		{"extra", "[[1]] Hola\n[[2]] Mundo\n[[3]] Otra", 2, nil, true},
+		{"reordered", "[[2]] Mundo\n[[1]] Hola", 2, nil, true},
+		{"empty", "[[1]] Hola\n[[2]]", 2, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitBatch(tt.response, tt.n)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitBatch failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
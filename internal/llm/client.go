@@ -4,28 +4,144 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"time"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
 )
 
+// placeholderPattern matches the inline markup placeholders and slot markers
+// produced by the translator.
+var placeholderPattern = regexp.MustCompile(`</?[gxn]\d+/?>`)
+
+// PromptVersion identifies how requests are built around the prompts
+// rendered from the prompt template. Bump it whenever that changes, so that
+// translations stored in a translation memory under the old requests are
+// not reused.
+const PromptVersion = "4"
+
 // Client implements the translator.LLMClient interface.
 type Client struct {
 	endpoint string
 	model    string
-	client   *http.Client
+	provider Provider
+	output   OutputMode
+	// apiKey is sent as a bearer token if it is not empty.
+	apiKey string
+	// maxTokens caps the length of replies if it is positive; seed and
+	// stop are passed on to the server if set.
+	maxTokens int
+	seed      *int
+	stop      []string
+	// keepAlive, if set, is how long Ollama keeps the model loaded after a
+	// request.
+	keepAlive *time.Duration
+	retry     RetryPolicy
+	// templates holds the prompt templates; template is the one selected
+	// for the model.
+	templates *prompt.Set
+	template  *prompt.Template
+	client    *http.Client
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithOutputMode selects how the model is asked to format its reply. The
+// default is OutputText.
+func WithOutputMode(mode OutputMode) ClientOption {
+	return func(c *Client) {
+		c.output = mode
+	}
+}
+
+// WithProvider selects the API the endpoint speaks. The default is
+// ProviderOllama.
+func WithProvider(provider Provider) ClientOption {
+	return func(c *Client) {
+		c.provider = provider
+	}
+}
+
+// WithAPIKey sends key as a bearer token with every request.
+func WithAPIKey(key string) ClientOption {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithMaxTokens caps the number of tokens the model generates per reply.
+// A value of 0 leaves the server's default.
+func WithMaxTokens(n int) ClientOption {
+	return func(c *Client) {
+		c.maxTokens = n
+	}
+}
+
+// WithSeed sets the sampling seed, for servers that sample even at zero
+// temperature.
+func WithSeed(seed int) ClientOption {
+	return func(c *Client) {
+		c.seed = &seed
+	}
+}
+
+// WithStop sets sequences that end the model's reply.
+func WithStop(stop ...string) ClientOption {
+	return func(c *Client) {
+		c.stop = stop
+	}
+}
+
+// WithTimeout sets the timeout of a single request to the server. The
+// default is 60 seconds.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.client.Timeout = d
+	}
+}
+
+// WithKeepAlive sets how long Ollama keeps the model loaded after a
+// request; a negative duration keeps it loaded indefinitely. Other
+// providers ignore it.
+func WithKeepAlive(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.keepAlive = &d
+	}
+}
+
+// WithPromptTemplates sets the prompt templates the client selects its
+// model's template from. The default is prompt.Defaults().
+func WithPromptTemplates(set *prompt.Set) ClientOption {
+	return func(c *Client) {
+		c.templates = set
+	}
 }
 
 // NewClient creates a new LLM client.
-func NewClient(endpoint, model string) *Client {
-	return &Client{
-		endpoint: endpoint,
-		model:    model,
+func NewClient(endpoint, model string, opts ...ClientOption) *Client {
+	c := &Client{
+		endpoint:  endpoint,
+		model:     model,
+		provider:  ProviderOllama,
+		output:    OutputText,
+		templates: prompt.Defaults(),
+		retry:     DefaultRetryPolicy,
 		client: &http.Client{
-			Timeout: 60 * time.Second, // Adjust timeout as needed
+			Timeout: 60 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.template = c.templates.Select(model)
+	return c
 }
 
 // GetModelName returns the model name.
@@ -33,51 +149,143 @@ func (c *Client) GetModelName() string {
 	return c.model
 }
 
+// PromptTemplate returns the name and hash of the prompt template selected
+// for the model.
+func (c *Client) PromptTemplate() (name, hash string) {
+	return c.template.Name, c.template.Hash
+}
+
+// PromptVersion returns the version of the prompts the client sends.
+func (c *Client) PromptVersion() string {
+	v := PromptVersion + "-" + c.template.Hash
+	if c.output == OutputJSON {
+		v += "-json"
+	}
+	return v
+}
+
+// vars returns the template variables of a request, with the hints carried
+// by ctx.
+func (c *Client) vars(ctx context.Context, sourceLang, targetLang string, texts ...string) prompt.Vars {
+	v := prompt.Vars{
+		SourceLang: lang.Name(sourceLang),
+		TargetLang: lang.Name(targetLang),
+		SourceTag:  sourceLang,
+		TargetTag:  targetLang,
+		Texts:      texts,
+		Hints:      prompt.HintsFromContext(ctx),
+	}
+	if len(texts) == 1 {
+		v.Text = texts[0]
+	}
+	for _, text := range texts {
+		if placeholderPattern.MatchString(text) {
+			// Inline markup is sent as numbered placeholders that must
+			// survive translation.
+			v.Placeholders = true
+		}
+	}
+	return v
+}
+
 // TranslateText sends a translation request to the local LLM.
-// This example assumes an Ollama-compatible API or similar simple JSON interface.
-// Adjust the request/response structure based on the actual local server.
 func (c *Client) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
-	// Refined prompt: use a "completion" style rather than "chat" to avoid conversational filler.
-	// We wrap it in a strict pattern.
-	prompt := fmt.Sprintf(`Translate the english text "%s" to %s. return only the translated string.`, text, targetLang)
-
-	reqBody := map[string]interface{}{
-		"model":  c.model,
-		"prompt": prompt,
-		"stream": false,
-		"options": map[string]interface{}{
-			"temperature": 0.0, // Zero temperature for maximum determinism
-		},
+	if c.output == OutputJSON {
+		translated, err := c.translateJSON(ctx, text, sourceLang, targetLang)
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			return translated, err
+		}
+		// The server does not enforce the schema; fall back to plain text.
 	}
 
+	v := c.vars(ctx, sourceLang, targetLang, text)
+	system, err := c.template.System(v)
+	if err != nil {
+		return "", err
+	}
+	p, err := c.template.Prompt(v)
+	if err != nil {
+		return "", err
+	}
+	return c.generate(ctx, request{system: system, prompt: p, texts: []string{text}})
+}
+
+// request is a single request to the model.
+type request struct {
+	// system is the system prompt, if any, and prompt the prompt.
+	system string
+	prompt string
+	// format, if not nil, is a JSON schema the reply must conform to.
+	format interface{}
+	// texts are the source texts the prompt asks to translate, for
+	// providers that constrain the shape of the reply.
+	texts []string
+}
+
+// generate sends req to the local LLM in the shape of the client's provider
+// and returns its response.
+func (c *Client) generate(ctx context.Context, req request) (string, error) {
+	switch c.provider {
+	case ProviderOpenAI:
+		return c.chatCompletion(ctx, req)
+	case ProviderOllamaChat:
+		return c.ollamaChat(ctx, req)
+	case ProviderLlamaCpp:
+		return c.llamaCompletion(ctx, req)
+	default:
+		return c.ollamaGenerate(ctx, req)
+	}
+}
+
+// post sends reqBody as JSON to the endpoint and decodes the JSON response
+// into respBody, retrying as the client's RetryPolicy allows. Failures are
+// returned as a *RequestError unless ctx ended. Every attempt is reported
+// with translator.RecordLatency or translator.RecordOverload.
+func (c *Client) post(ctx context.Context, reqBody, respBody interface{}) error {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
+	return c.withRetries(ctx, func() error {
+		start := time.Now()
+		err := c.postOnce(ctx, jsonBody, respBody)
+		var reqErr *RequestError
+		switch {
+		case err == nil:
+			translator.RecordLatency(ctx, time.Since(start))
+		case errors.As(err, &reqErr) && reqErr.overloaded():
+			translator.RecordOverload(ctx)
+		}
+		return err
+	})
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(jsonBody))
+// postOnce sends a single request for post.
+func (c *Client) postOnce(ctx context.Context, jsonBody []byte, respBody interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return classifyTransport(ctx, fmt.Errorf("failed to send request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LLM server returned status %d: %s", resp.StatusCode, string(body))
+		return classifyResponse(resp, body)
 	}
 
-	var respBody struct {
-		Response string `json:"response"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
+		// The connection was most likely cut off mid-response.
+		return classifyTransport(ctx, fmt.Errorf("failed to decode response: %w", err))
 	}
-
-	return respBody.Response, nil
+	return nil
 }
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of RequestError. Test for them with errors.Is.
+var (
+	// ErrTransient is a failure that may not recur: a timeout, a dropped
+	// connection, or a server that is overloaded or restarting.
+	ErrTransient = errors.New("transient LLM server error")
+	// ErrRateLimited is a request refused for exceeding a rate limit.
+	ErrRateLimited = errors.New("LLM server rate limit exceeded")
+	// ErrBadRequest is a request the server will always refuse.
+	ErrBadRequest = errors.New("LLM server rejected the request")
+	// ErrModelNotFound is a request for a model the server does not have.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrContextOverflow is a prompt longer than the model's context
+	// window.
+	ErrContextOverflow = errors.New("prompt exceeds the model's context length")
+)
+
+// RequestError is a failed request to the model server, classified by
+// Kind, one of the errors above.
+type RequestError struct {
+	Kind error
+	// StatusCode is the HTTP status of the response, or 0 if there was
+	// none.
+	StatusCode int
+	// RetryAfter is the delay the server asked for before a retry, if any.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns both the kind and the underlying error.
+func (e *RequestError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// retryable reports whether the request may succeed if sent again.
+func (e *RequestError) retryable() bool {
+	return e.Kind == ErrTransient || e.Kind == ErrRateLimited
+}
+
+// overloaded reports whether the request failed because the server is
+// overloaded: it was rate limited, answered 503 or timed out.
+func (e *RequestError) overloaded() bool {
+	var netErr net.Error
+	return e.Kind == ErrRateLimited || e.StatusCode == http.StatusServiceUnavailable ||
+		e.StatusCode == 0 && errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// contextOverflowPattern matches the error messages of servers refusing a
+// prompt longer than the context window: llama.cpp, vLLM, OpenAI and
+// Ollama.
+var contextOverflowPattern = regexp.MustCompile(`(?i)context[ _]length|context size|context window|maximum context|too many tokens|prompt is too long`)
+
+// modelNotFoundPattern matches the error messages of servers that do not
+// have the requested model.
+var modelNotFoundPattern = regexp.MustCompile(`(?i)model.*not found|model_not_found|no such model|does not exist`)
+
+// classifyResponse returns the error for a response with a non-200 status.
+func classifyResponse(resp *http.Response, body []byte) *RequestError {
+	e := &RequestError{
+		StatusCode: resp.StatusCode,
+		Err:        fmt.Errorf("LLM server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body))),
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	case contextOverflowPattern.Match(body):
+		e.Kind = ErrContextOverflow
+	case resp.StatusCode == http.StatusNotFound && modelNotFoundPattern.Match(body):
+		e.Kind = ErrModelNotFound
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		e.Kind = ErrTransient
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	default:
+		e.Kind = ErrBadRequest
+	}
+	return e
+}
+
+// classifyTransport returns the error for a request that got no response.
+// Errors caused by ctx are returned as they are: the caller gave up.
+func classifyTransport(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	return &RequestError{Kind: ErrTransient, Err: err}
+}
+
+// parseRetryAfter parses a Retry-After header: a number of seconds or an
+// HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
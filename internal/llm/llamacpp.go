@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// llamaCompletion sends req to llama.cpp's native /completion endpoint. The
+// endpoint does not apply a chat template, so the system prompt is prepended
+// to the prompt. A JSON schema is sent as "json_schema"; otherwise the reply
+// is constrained by a GBNF grammar built from the source texts.
+func (c *Client) llamaCompletion(ctx context.Context, req request) (string, error) {
+	prompt := req.prompt
+	if req.system != "" {
+		prompt = req.system + "\n\n" + prompt
+	}
+	reqBody := map[string]interface{}{
+		"prompt":       prompt,
+		"stream":       false,
+		"temperature":  0.0,
+		"cache_prompt": true,
+	}
+	if c.maxTokens > 0 {
+		reqBody["n_predict"] = c.maxTokens
+	}
+	if c.seed != nil {
+		reqBody["seed"] = *c.seed
+	}
+	if len(c.stop) > 0 {
+		reqBody["stop"] = c.stop
+	}
+	if req.format != nil {
+		reqBody["json_schema"] = req.format
+	} else if grammar := replyGrammar(req.texts); grammar != "" {
+		reqBody["grammar"] = grammar
+	}
+
+	var respBody struct {
+		Content      string `json:"content"`
+		StoppedLimit bool   `json:"stopped_limit"`
+	}
+	if err := c.post(ctx, reqBody, &respBody); err != nil {
+		return "", err
+	}
+	if respBody.StoppedLimit {
+		return "", errors.New("reply was cut off at the token limit")
+	}
+	return respBody.Content, nil
+}
+
+// quoteChars open quoted text; a reply may only start with one if its
+// source does.
+const quoteChars = `"'“”‘’«»„「『`
+
+// replyGrammar returns a GBNF grammar that admits only replies shaped like
+// the translations of texts, leaving the model no room for preambles and
+// notes: one line per line of the source, no colon unless the source has
+// one ("Here is the translation:"), and no opening quote unless the source
+// starts with one. For several texts, the reply must be the [[n]]-numbered
+// list of translations. It returns "" if texts is empty, or if a text of a
+// batch spans several lines.
+func replyGrammar(texts []string) string {
+	if len(texts) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	if len(texts) == 1 {
+		b.WriteString("root ::= first rest\n")
+		fmt.Fprintf(&b, "first ::= %s\n", charClass(texts[0], true))
+		fmt.Fprintf(&b, "rest ::= %s*\n", charClass(texts[0], false))
+		return b.String()
+	}
+	b.WriteString("root ::=")
+	for i, text := range texts {
+		if strings.ContainsAny(text, "\r\n") {
+			return ""
+		}
+		sep := `\n`
+		if i == 0 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, ` "%s[[%d]] " line%d`, sep, i+1, i+1)
+	}
+	b.WriteString("\n")
+	for i, text := range texts {
+		fmt.Fprintf(&b, "line%d ::= %s %s*\n", i+1, charClass(text, true), charClass(text, false))
+	}
+	return b.String()
+}
+
+// charClass returns the GBNF character class of the characters allowed in
+// the translation of text, at its start if first is set.
+func charClass(text string, first bool) string {
+	var excluded []string
+	if !strings.ContainsAny(text, "\r\n") {
+		excluded = append(excluded, `\n`, `\r`)
+	}
+	if !strings.ContainsAny(text, ":：") {
+		excluded = append(excluded, ":", "：")
+	}
+	if first {
+		excluded = append(excluded, " ", `\t`)
+		if !strings.ContainsAny(firstRune(text), quoteChars) {
+			for _, q := range quoteChars {
+				if q == '"' {
+					excluded = append(excluded, `\"`)
+				} else {
+					excluded = append(excluded, string(q))
+				}
+			}
+		}
+	}
+	if len(excluded) == 0 {
+		return "[^\\x00]"
+	}
+	return "[^" + strings.Join(excluded, "") + "]"
+}
+
+// firstRune returns the first character of s, as a string.
+func firstRune(s string) string {
+	for _, r := range s {
+		return string(r)
+	}
+	return ""
+}
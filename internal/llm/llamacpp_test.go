@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLlamaCpp_TranslateText(t *testing.T) {
+	srv, requests := fakeServer(t, func(map[string]interface{}) interface{} {
+		return map[string]interface{}{"content": "Plutôt ensoleillé", "stopped_limit": false}
+	})
+	c := NewClient(srv.URL, "llama3.1", WithProvider(ProviderLlamaCpp), WithMaxTokens(64))
+
+	translated, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "fr")
+	if err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	if translated != "Plutôt ensoleillé" {
+		t.Errorf("Expected %q, got %q", "Plutôt ensoleillé", translated)
+	}
+	req := (*requests)[0]
+	prompt, _ := req["prompt"].(string)
+	if !strings.HasPrefix(prompt, "You are a professional translator.") || !strings.HasSuffix(prompt, "\n\nMostly sunny") {
+		t.Errorf("Expected the system prompt before the prompt, got %q", prompt)
+	}
+	if req["grammar"] != replyGrammar([]string{"Mostly sunny"}) {
+		t.Errorf("Expected the reply grammar, got %v", req["grammar"])
+	}
+	if req["n_predict"] != 64.0 || req["temperature"] != 0.0 {
+		t.Errorf("Expected n_predict and temperature, got %v and %v", req["n_predict"], req["temperature"])
+	}
+}
+
+func TestLlamaCpp_JSON(t *testing.T) {
+	srv, requests := fakeServer(t, func(map[string]interface{}) interface{} {
+		return map[string]interface{}{"content": `{"translation": "Hola"}`}
+	})
+	c := NewClient(srv.URL, "test-model", WithProvider(ProviderLlamaCpp), WithOutputMode(OutputJSON))
+
+	if _, err := c.TranslateText(context.Background(), "Hello", "en", "es"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	req := (*requests)[0]
+	if req["json_schema"] == nil || req["grammar"] != nil {
+		t.Errorf("Expected a JSON schema and no grammar, got %v and %v", req["json_schema"], req["grammar"])
+	}
+}
+
+func TestLlamaCpp_StoppedLimit(t *testing.T) {
+	srv, _ := fakeServer(t, func(map[string]interface{}) interface{} {
+		return map[string]interface{}{"content": "Plutôt", "stopped_limit": true}
+	})
+	c := NewClient(srv.URL, "test-model", WithProvider(ProviderLlamaCpp), WithMaxTokens(1))
+
+	if _, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "fr"); err == nil {
+		t.Error("Expected an error for a truncated reply")
+	}
+}
+
+func TestReplyGrammar(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  string
+	}{
+		{
+			name:  "plain",
+			texts: []string{"Mostly sunny"},
+			want: "root ::= first rest\n" +
+				`first ::= [^\n\r:： \t\"'“”‘’«»„「『]` + "\n" +
+				`rest ::= [^\n\r:：]*` + "\n",
+		},
+		{
+			name:  "colon and quote",
+			texts: []string{`"Hazards: heat"`},
+			want: "root ::= first rest\n" +
+				`first ::= [^\n\r \t]` + "\n" +
+				`rest ::= [^\n\r]*` + "\n",
+		},
+		{
+			name:  "multiline",
+			texts: []string{"Tonight\nClear: 68"},
+			want: "root ::= first rest\n" +
+				`first ::= [^ \t\"'“”‘’«»„「『]` + "\n" +
+				`rest ::= [^\x00]*` + "\n",
+		},
+		{
+			name:  "batch",
+			texts: []string{"One", "At 4:00 PM"},
+			want: `root ::= "[[1]] " line1 "\n[[2]] " line2` + "\n" +
+				`line1 ::= [^\n\r:： \t\"'“”‘’«»„「『] [^\n\r:：]*` + "\n" +
+				`line2 ::= [^\n\r \t\"'“”‘’«»„「『] [^\n\r]*` + "\n",
+		},
+		{name: "multiline batch", texts: []string{"One", "Two\nThree"}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replyGrammar(tt.texts); got != tt.want {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// ollamaOptions returns the model options of an Ollama request.
+func (c *Client) ollamaOptions() map[string]interface{} {
+	options := map[string]interface{}{
+		"temperature": 0.0, // Zero temperature for maximum determinism
+	}
+	if c.maxTokens > 0 {
+		options["num_predict"] = c.maxTokens
+	}
+	if c.seed != nil {
+		options["seed"] = *c.seed
+	}
+	if len(c.stop) > 0 {
+		options["stop"] = c.stop
+	}
+	return options
+}
+
+// ollamaRequest returns the fields shared by Ollama's generate and chat
+// requests. A JSON schema goes in the "format" field as it is.
+func (c *Client) ollamaRequest(req request) map[string]interface{} {
+	reqBody := map[string]interface{}{
+		"model":   c.model,
+		"stream":  false,
+		"options": c.ollamaOptions(),
+	}
+	if c.keepAlive != nil {
+		// Seconds; negative keeps the model loaded indefinitely.
+		keepAlive := int(c.keepAlive.Seconds())
+		if *c.keepAlive < 0 {
+			keepAlive = -1
+		}
+		reqBody["keep_alive"] = keepAlive
+	}
+	if req.format != nil {
+		reqBody["format"] = req.format
+	}
+	return reqBody
+}
+
+// ollamaGenerate sends req to Ollama's /api/generate endpoint, which
+// applies the model's chat template to the system prompt and prompt.
+func (c *Client) ollamaGenerate(ctx context.Context, req request) (string, error) {
+	reqBody := c.ollamaRequest(req)
+	reqBody["prompt"] = req.prompt
+	if req.system != "" {
+		reqBody["system"] = req.system
+	}
+
+	var respBody struct {
+		Response   string `json:"response"`
+		DoneReason string `json:"done_reason"`
+	}
+	if err := c.post(ctx, reqBody, &respBody); err != nil {
+		return "", err
+	}
+	if respBody.DoneReason == "length" {
+		return "", errors.New("reply was cut off at the token limit")
+	}
+	return respBody.Response, nil
+}
+
+// ollamaChat sends req to Ollama's /api/chat endpoint as a system and a user
+// message.
+func (c *Client) ollamaChat(ctx context.Context, req request) (string, error) {
+	reqBody := c.ollamaRequest(req)
+	reqBody["messages"] = req.messages()
+
+	var respBody struct {
+		Message    chatMessage `json:"message"`
+		DoneReason string      `json:"done_reason"`
+	}
+	if err := c.post(ctx, reqBody, &respBody); err != nil {
+		return "", err
+	}
+	if respBody.DoneReason == "length" {
+		return "", errors.New("reply was cut off at the token limit")
+	}
+	return respBody.Message.Content, nil
+}
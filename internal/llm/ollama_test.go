@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOllamaChat_TranslateText(t *testing.T) {
+	srv, requests := fakeServer(t, func(map[string]interface{}) interface{} {
+		return map[string]interface{}{
+			"message":     map[string]string{"role": "assistant", "content": "Mayormente soleado"},
+			"done_reason": "stop",
+		}
+	})
+	c := NewClient(srv.URL, "qwen2.5:7b", WithProvider(ProviderOllamaChat), WithKeepAlive(10*time.Minute), WithSeed(7))
+
+	translated, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "es")
+	if err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	if translated != "Mayormente soleado" {
+		t.Errorf("Expected %q, got %q", "Mayormente soleado", translated)
+	}
+	req := (*requests)[0]
+	messages, _ := req["messages"].([]interface{})
+	if len(messages) != 2 {
+		t.Fatalf("Expected a system and a user message, got %v", req["messages"])
+	}
+	if m := messages[1].(map[string]interface{}); m["role"] != "user" || m["content"] != "Mostly sunny" {
+		t.Errorf("Expected the text as user message, got %v", m)
+	}
+	if req["keep_alive"] != 600.0 {
+		t.Errorf("Expected keep_alive 600, got %v", req["keep_alive"])
+	}
+	if options, _ := req["options"].(map[string]interface{}); options["seed"] != 7.0 {
+		t.Errorf("Expected the seed in the options, got %v", req["options"])
+	}
+}
+
+func TestOllamaGenerate_Options(t *testing.T) {
+	srv, requests := fakeServer(t, func(map[string]interface{}) interface{} {
+		return map[string]interface{}{"response": "Hola", "done_reason": "stop"}
+	})
+	c := NewClient(srv.URL, "test-model", WithKeepAlive(-1), WithMaxTokens(32), WithStop("\n"))
+
+	if _, err := c.TranslateText(context.Background(), "Hello", "en", "es"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	req := (*requests)[0]
+	if req["keep_alive"] != -1.0 {
+		t.Errorf("Expected a negative keep_alive, got %v", req["keep_alive"])
+	}
+	options, _ := req["options"].(map[string]interface{})
+	if options["num_predict"] != 32.0 || options["temperature"] != 0.0 {
+		t.Errorf("Expected num_predict and temperature in the options, got %v", options)
+	}
+	if req["system"] != nil {
+		t.Errorf("Expected no system prompt for the default template, got %v", req["system"])
+	}
+}
+
+func TestOllama_Truncated(t *testing.T) {
+	for _, provider := range []Provider{ProviderOllama, ProviderOllamaChat} {
+		srv, _ := fakeServer(t, func(map[string]interface{}) interface{} {
+			return map[string]interface{}{
+				"response":    "Mayormente",
+				"message":     map[string]string{"role": "assistant", "content": "Mayormente"},
+				"done_reason": "length",
+			}
+		})
+		c := NewClient(srv.URL, "test-model", WithProvider(provider))
+		if _, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "es"); err == nil {
+			t.Errorf("%s: expected an error for a truncated reply", provider)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// chatMessage is a message of a chat request, shared by the OpenAI and
+// Ollama chat APIs.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// messages returns the chat messages of req: the system prompt, if any, and
+// the prompt as the user message.
+func (req request) messages() []chatMessage {
+	var messages []chatMessage
+	if req.system != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: req.system})
+	}
+	return append(messages, chatMessage{Role: "user", Content: req.prompt})
+}
+
+// chatCompletion sends req as an OpenAI chat completion. A JSON schema is
+// sent as a strict json_schema response format.
+func (c *Client) chatCompletion(ctx context.Context, req request) (string, error) {
+	reqBody := map[string]interface{}{
+		"model":       c.model,
+		"messages":    req.messages(),
+		"stream":      false,
+		"temperature": 0.0,
+	}
+	if c.maxTokens > 0 {
+		reqBody["max_tokens"] = c.maxTokens
+	}
+	if c.seed != nil {
+		reqBody["seed"] = *c.seed
+	}
+	if len(c.stop) > 0 {
+		reqBody["stop"] = c.stop
+	}
+	if req.format != nil {
+		reqBody["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "translation",
+				"strict": true,
+				"schema": req.format,
+			},
+		}
+	}
+
+	var respBody struct {
+		Choices []struct {
+			Message      chatMessage `json:"message"`
+			FinishReason string      `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := c.post(ctx, reqBody, &respBody); err != nil {
+		return "", err
+	}
+	if len(respBody.Choices) == 0 {
+		return "", errors.New("chat completion has no choices")
+	}
+	choice := respBody.Choices[0]
+	if choice.FinishReason == "length" {
+		return "", errors.New("reply was cut off at the token limit")
+	}
+	return choice.Message.Content, nil
+}
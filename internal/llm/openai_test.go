@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chatRequest is the part of a chat completion request the tests inspect.
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    *float64        `json:"temperature"`
+	MaxTokens      int             `json:"max_tokens"`
+	Seed           *int            `json:"seed"`
+	Stop           []string        `json:"stop"`
+	ResponseFormat json.RawMessage `json:"response_format"`
+	// Header holds the headers of the request.
+	Header http.Header `json:"-"`
+}
+
+func (req *chatRequest) recordHeader(h http.Header) {
+	req.Header = h
+}
+
+// completed returns the body of a chat completion response with content
+// and finishReason.
+func completed(content, finishReason string) interface{} {
+	return map[string]interface{}{
+		"id":     "chatcmpl-1",
+		"object": "chat.completion",
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": finishReason,
+		}},
+	}
+}
+
+func TestOpenAI_TranslateText(t *testing.T) {
+	srv, requests := fakeServer(t, func(req chatRequest) interface{} {
+		return completed("Mayormente soleado", "stop")
+	})
+	c := NewClient(srv.URL+"/v1/chat/completions", "qwen2.5-7b-instruct",
+		WithProvider(ProviderOpenAI), WithAPIKey("secret"), WithMaxTokens(256), WithSeed(42), WithStop("\n\n"))
+
+	translated, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "es")
+	if err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	if translated != "Mayormente soleado" {
+		t.Errorf("Expected %q, got %q", "Mayormente soleado", translated)
+	}
+
+	if got := (*requests)[0].Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Expected the bearer token, got %q", got)
+	}
+	req := (*requests)[0]
+	if req.Model != "qwen2.5-7b-instruct" {
+		t.Errorf("Expected the model name, got %q", req.Model)
+	}
+	// qwen gets the instruct template: a system prompt and the bare text.
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1] != (chatMessage{Role: "user", Content: "Mostly sunny"}) {
+		t.Errorf("Expected a system and a user message, got %+v", req.Messages)
+	}
+	if req.Temperature == nil || *req.Temperature != 0 {
+		t.Errorf("Expected temperature 0, got %v", req.Temperature)
+	}
+	if req.MaxTokens != 256 || req.Seed == nil || *req.Seed != 42 || !reflect.DeepEqual(req.Stop, []string{"\n\n"}) {
+		t.Errorf("Expected max_tokens, seed and stop, got %d, %v, %q", req.MaxTokens, req.Seed, req.Stop)
+	}
+	if len(req.ResponseFormat) != 0 {
+		t.Errorf("Expected no response format in text mode, got %s", req.ResponseFormat)
+	}
+}
+
+func TestOpenAI_NoSystemPrompt(t *testing.T) {
+	srv, requests := fakeServer(t, func(req chatRequest) interface{} {
+		return completed("Hola", "stop")
+	})
+	c := NewClient(srv.URL+"/v1/chat/completions", "test-model", WithProvider(ProviderOpenAI))
+
+	if _, err := c.TranslateText(context.Background(), "Hello", "en", "es"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	req := (*requests)[0]
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || !strings.Contains(req.Messages[0].Content, `"Hello"`) {
+		t.Errorf("Expected a single user message, got %+v", req.Messages)
+	}
+	if req.MaxTokens != 0 || req.Seed != nil || req.Stop != nil {
+		t.Errorf("Expected no max_tokens, seed or stop, got %d, %v, %q", req.MaxTokens, req.Seed, req.Stop)
+	}
+	if got := (*requests)[0].Header.Get("Authorization"); got != "" {
+		t.Errorf("Expected no Authorization header, got %q", got)
+	}
+}
+
+func TestOpenAI_JSON(t *testing.T) {
+	srv, requests := fakeServer(t, func(req chatRequest) interface{} {
+		return completed(`{"translations": ["Uno", "Dos"]}`, "stop")
+	})
+	c := NewClient(srv.URL+"/v1/chat/completions", "test-model", WithProvider(ProviderOpenAI), WithOutputMode(OutputJSON))
+
+	translated, err := c.TranslateBatch(context.Background(), []string{"One", "Two"}, "en", "es")
+	if err != nil {
+		t.Fatalf("TranslateBatch failed: %v", err)
+	}
+	if !reflect.DeepEqual(translated, []string{"Uno", "Dos"}) {
+		t.Errorf("Expected [Uno Dos], got %q", translated)
+	}
+	var format struct {
+		Type       string `json:"type"`
+		JSONSchema struct {
+			Strict bool                   `json:"strict"`
+			Schema map[string]interface{} `json:"schema"`
+		} `json:"json_schema"`
+	}
+	if err := json.Unmarshal((*requests)[0].ResponseFormat, &format); err != nil {
+		t.Fatalf("Invalid response format: %v", err)
+	}
+	if format.Type != "json_schema" || !format.JSONSchema.Strict || format.JSONSchema.Schema["type"] != "object" {
+		t.Errorf("Expected a strict json_schema response format, got %s", (*requests)[0].ResponseFormat)
+	}
+}
+
+func TestOpenAI_Errors(t *testing.T) {
+	t.Run("truncated", func(t *testing.T) {
+		srv, _ := fakeServer(t, func(req chatRequest) interface{} {
+			return completed("Mayormente", "length")
+		})
+		c := NewClient(srv.URL+"/v1/chat/completions", "test-model", WithProvider(ProviderOpenAI), WithMaxTokens(1))
+		if _, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "es"); err == nil {
+			t.Error("Expected an error for a truncated reply")
+		}
+	})
+	t.Run("status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error": {"message": "invalid api key"}}`, http.StatusUnauthorized)
+		}))
+		defer srv.Close()
+		c := NewClient(srv.URL, "test-model", WithProvider(ProviderOpenAI))
+		_, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "es")
+		if err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("Expected a status error, got %v", err)
+		}
+	})
+	t.Run("no choices", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"choices": []}`))
+		}))
+		defer srv.Close()
+		c := NewClient(srv.URL, "test-model", WithProvider(ProviderOpenAI))
+		if _, err := c.TranslateText(context.Background(), "Mostly sunny", "en", "es"); err == nil {
+			t.Error("Expected an error for a reply without choices")
+		}
+	})
+}
+
+func TestParseProvider(t *testing.T) {
+	for s, want := range map[string]Provider{"": ProviderOllama, "ollama": ProviderOllama, "OpenAI": ProviderOpenAI} {
+		if got, err := ParseProvider(s); err != nil || got != want {
+			t.Errorf("ParseProvider(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseProvider("bedrock"); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
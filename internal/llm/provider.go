@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Provider names the API a model server speaks.
+type Provider string
+
+const (
+	// ProviderOllama is Ollama's /api/generate endpoint.
+	ProviderOllama Provider = "ollama"
+	// ProviderOllamaChat is Ollama's /api/chat endpoint.
+	ProviderOllamaChat Provider = "ollama-chat"
+	// ProviderLlamaCpp is llama.cpp's native /completion endpoint, which
+	// constrains replies with a grammar.
+	ProviderLlamaCpp Provider = "llamacpp"
+	// ProviderOpenAI is the OpenAI chat completions endpoint,
+	// /v1/chat/completions, served by vLLM, LM Studio, llama.cpp's server
+	// and others.
+	ProviderOpenAI Provider = "openai"
+)
+
+// ParseProvider parses a provider name. The empty string means
+// ProviderOllama.
+func ParseProvider(s string) (Provider, error) {
+	switch p := Provider(strings.ToLower(s)); p {
+	case "":
+		return ProviderOllama, nil
+	case ProviderOllama, ProviderOllamaChat, ProviderLlamaCpp, ProviderOpenAI:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown LLM provider %q (want ollama, ollama-chat, llamacpp or openai)", s)
+}
+
+// DefaultEndpoint returns the endpoint of the provider's server on the local
+// machine with its default port.
+func DefaultEndpoint(p Provider) string {
+	switch p {
+	case ProviderOllamaChat:
+		return "http://localhost:11434/api/chat"
+	case ProviderLlamaCpp:
+		return "http://localhost:8080/completion"
+	case ProviderOpenAI:
+		return "http://localhost:8000/v1/chat/completions"
+	}
+	return "http://localhost:11434/api/generate"
+}
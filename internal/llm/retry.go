@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
+)
+
+// RetryPolicy controls how requests failing with ErrTransient or
+// ErrRateLimited are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, including the
+	// first; 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// further retry, up to MaxDelay, and each delay is randomly shortened
+	// by up to half so that concurrent requests do not retry in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a Client.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// WithRetryPolicy sets the retry policy. The default is DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// delay returns the delay before retry n, counting from 1.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// withRetries calls send until it succeeds, fails with an error that is not
+// retryable, or the policy's attempts are used up. It does not wait for a
+// retry that would end after ctx's deadline, and reports every retry with
+// translator.RecordRetry.
+func (c *Client) withRetries(ctx context.Context, send func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := send()
+		var reqErr *RequestError
+		if err == nil || !errors.As(err, &reqErr) || !reqErr.retryable() || attempt >= c.retry.MaxAttempts {
+			return err
+		}
+
+		wait := c.retry.delay(attempt)
+		if reqErr.RetryAfter > wait {
+			wait = reqErr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		translator.RecordRetry(ctx)
+	}
+}
@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
+)
+
+// fastRetries retries without noticeable delays.
+var fastRetries = WithRetryPolicy(RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond})
+
+// flakyServer fails the first failures requests with status and body, then
+// answers "Hola".
+func flakyServer(t *testing.T, failures int, status int, body string) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= int64(failures) {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "30")
+			}
+			http.Error(w, body, status)
+			return
+		}
+		w.Write([]byte(`{"response": "Hola"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestClient_RetriesTransientErrors(t *testing.T) {
+	srv, requests := flakyServer(t, 2, http.StatusServiceUnavailable, "server busy")
+	c := NewClient(srv.URL, "test-model", fastRetries)
+
+	// Retries are reported through the translator's metadata.
+	service := translator.NewService(c)
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader("<p>Hello</p>"), "en", "es", translator.WithFragment(""))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != "<p>Hola</p>" {
+		t.Errorf("Expected %q, got %q", "<p>Hola</p>", translated)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected 3 requests, got %d", n)
+	}
+	if want := []translator.SegmentRetries{{Segment: 0, Retries: 2}}; !reflect.DeepEqual(metadata.Retries, want) {
+		t.Errorf("Expected retries %+v, got %+v", want, metadata.Retries)
+	}
+}
+
+func TestClient_ReportsLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		overloads int64
+	}{
+		{"overloaded", http.StatusServiceUnavailable, 2},
+		{"server error", http.StatusBadGateway, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := flakyServer(t, 2, tt.status, "busy")
+			c := NewClient(srv.URL, "test-model", fastRetries)
+
+			scheduler := translator.NewScheduler(5)
+			service := translator.NewService(c, translator.WithScheduler(scheduler))
+			if _, _, err := service.Translate(context.Background(), strings.NewReader("<p>Hello</p>"), "en", "es"); err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			st := scheduler.Stats()
+			if st.Overloads != tt.overloads {
+				t.Errorf("Expected %d overloads, got %d", tt.overloads, st.Overloads)
+			}
+			if st.Latency.Requests != 1 {
+				t.Errorf("Expected the latency of 1 successful request, got %d", st.Latency.Requests)
+			}
+		})
+	}
+}
+
+func TestClient_TimeoutIsOverload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	t.Cleanup(srv.Close)
+	c := NewClient(srv.URL, "test-model", WithTimeout(10*time.Millisecond), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	_, err := c.TranslateText(context.Background(), "Hello", "en", "es")
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) || !reqErr.overloaded() {
+		t.Errorf("Expected a timeout to count as overload, got %v", err)
+	}
+}
+
+func TestClient_GivesUp(t *testing.T) {
+	srv, requests := flakyServer(t, 100, http.StatusBadGateway, "bad gateway")
+	c := NewClient(srv.URL, "test-model", fastRetries)
+
+	_, err := c.TranslateText(context.Background(), "Hello", "en", "es")
+	if !errors.Is(err, ErrTransient) {
+		t.Errorf("Expected ErrTransient, got %v", err)
+	}
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) || reqErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected a RequestError with status 502, got %v", err)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("Expected 4 requests, got %d", n)
+	}
+}
+
+func TestClient_DoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"model not found", http.StatusNotFound, `{"error":"model 'llama9' not found, try pulling it first"}`, ErrModelNotFound},
+		{"context overflow", http.StatusBadRequest, `{"error":{"message":"This model's maximum context length is 4096 tokens."}}`, ErrContextOverflow},
+		{"llama.cpp context overflow", http.StatusInternalServerError, `{"error":{"message":"the request exceeds the available context size"}}`, ErrContextOverflow},
+		{"bad request", http.StatusBadRequest, `{"error":"invalid options"}`, ErrBadRequest},
+		{"unauthorized", http.StatusUnauthorized, `invalid api key`, ErrBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := flakyServer(t, 100, tt.status, tt.body)
+			c := NewClient(srv.URL, "test-model", fastRetries)
+
+			_, err := c.TranslateText(context.Background(), "Hello", "en", "es")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("Expected 1 request, got %d", n)
+			}
+		})
+	}
+}
+
+func TestClient_RetryRespectsDeadline(t *testing.T) {
+	srv, requests := flakyServer(t, 100, http.StatusTooManyRequests, "slow down")
+	c := NewClient(srv.URL, "test-model", fastRetries)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := c.TranslateText(ctx, "Hello", "en", "es")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	// Retry-After asks for 30s, beyond the deadline: no retry is made.
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Expected to give up at once, took %v", d)
+	}
+}
+
+func TestClient_TransportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	c := NewClient(srv.URL, "test-model", WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	_, err := c.TranslateText(context.Background(), "Hello", "en", "es")
+	if !errors.Is(err, ErrTransient) {
+		t.Errorf("Expected ErrTransient, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.TranslateText(ctx, "Hello", "en", "es")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 6: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := p.delay(n); d < max/2 || d > max {
+				t.Errorf("delay(%d) = %v, want between %v and %v", n, d, max/2, max)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("Expected 3s, got %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d < 50*time.Second || d > time.Minute {
+		t.Errorf("Expected about a minute, got %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("Expected 0, got %v", d)
+	}
+}
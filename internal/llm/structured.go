@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+)
+
+// OutputMode selects how the model is asked to format its reply.
+type OutputMode string
+
+const (
+	// OutputText asks for the bare translation in the reply text.
+	OutputText OutputMode = "text"
+	// OutputJSON sends the text as JSON and constrains the reply with a
+	// JSON schema, in Ollama's "format" field or as an OpenAI json_schema
+	// response format. A reply that violates the schema makes the request
+	// fall back to OutputText: the server does not enforce the schema.
+	OutputJSON OutputMode = "json"
+)
+
+// ParseOutputMode parses an output mode name. The empty string means
+// OutputText.
+func ParseOutputMode(s string) (OutputMode, error) {
+	switch m := OutputMode(strings.ToLower(s)); m {
+	case "":
+		return OutputText, nil
+	case OutputText, OutputJSON:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown output mode %q (want text or json)", s)
+}
+
+// SchemaError reports a reply that does not conform to the requested JSON
+// schema, which the server does not enforce.
+type SchemaError struct {
+	Reply string
+	Err   error
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("reply does not match the JSON schema: %v", e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// translationSchema constrains the reply to a single translation.
+var translationSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"translation": map[string]interface{}{"type": "string"},
+	},
+	"required":             []string{"translation"},
+	"additionalProperties": false,
+}
+
+// batchSchema constrains the reply to exactly n translations.
+func batchSchema(n int) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"translations": map[string]interface{}{
+				"type":     "array",
+				"items":    map[string]interface{}{"type": "string"},
+				"minItems": n,
+				"maxItems": n,
+			},
+		},
+		"required":             []string{"translations"},
+		"additionalProperties": false,
+	}
+}
+
+// translateJSON translates text with a structured request, prompting with
+// the json part of the client's template.
+func (c *Client) translateJSON(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	input, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal text: %w", err)
+	}
+	v := c.vars(ctx, sourceLang, targetLang, text)
+	v.JSON = string(input)
+	req, err := c.jsonRequest(v, c.template.JSON, translationSchema)
+	if err != nil {
+		return "", err
+	}
+
+	reply, err := generateJSON(ctx, c, req, func(r *struct {
+		Translation *string `json:"translation"`
+	}) error {
+		if r.Translation == nil {
+			return errors.New(`missing "translation"`)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return *reply.Translation, nil
+}
+
+// translateBatchJSON translates texts with a structured request, prompting
+// with the json-batch part of the client's template.
+func (c *Client) translateBatchJSON(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	input, err := json.Marshal(map[string][]string{"texts": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal texts: %w", err)
+	}
+	v := c.vars(ctx, sourceLang, targetLang, texts...)
+	v.JSON = string(input)
+	req, err := c.jsonRequest(v, c.template.JSONBatch, batchSchema(len(texts)))
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := generateJSON(ctx, c, req, func(r *struct {
+		Translations []string `json:"translations"`
+	}) error {
+		if len(r.Translations) != len(texts) {
+			return fmt.Errorf("got %d translations for %d texts", len(r.Translations), len(texts))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Translations, nil
+}
+
+// jsonRequest returns the request rendering v with the template's system
+// prompt and render, with schema as the reply format.
+func (c *Client) jsonRequest(v prompt.Vars, render func(prompt.Vars) (string, error), schema interface{}) (request, error) {
+	system, err := c.template.System(v)
+	if err != nil {
+		return request{}, err
+	}
+	p, err := render(v)
+	if err != nil {
+		return request{}, err
+	}
+	return request{system: system, prompt: p, format: schema}, nil
+}
+
+// generateJSON sends req and strictly decodes the reply, constrained to
+// req.format, into a T, which check validates. A reply that does not decode
+// or pass check is returned as a *SchemaError; it is not retried, as the
+// same request would get the same reply.
+func generateJSON[T any](ctx context.Context, c *Client, req request, check func(*T) error) (*T, error) {
+	response, err := c.generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	reply := new(T)
+	if err = decodeStrict(response, reply); err == nil {
+		err = check(reply)
+	}
+	if err != nil {
+		return nil, &SchemaError{Reply: response, Err: err}
+	}
+	return reply, nil
+}
+
+// decodeStrict decodes a single JSON value from s into v, rejecting
+// unknown fields and trailing data.
+func decodeStrict(s string, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
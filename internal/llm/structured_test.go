@@ -0,0 +1,237 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+)
+
+// generateRequest is the part of a generate request the tests inspect.
+type generateRequest struct {
+	System string          `json:"system"`
+	Prompt string          `json:"prompt"`
+	Format json.RawMessage `json:"format"`
+}
+
+// headerRecorder is implemented by request types that record the headers
+// of the request.
+type headerRecorder interface {
+	recordHeader(h http.Header)
+}
+
+// fakeServer answers every request with the JSON value reply returns for
+// it, recording the request bodies decoded as Req.
+func fakeServer[Req any](t *testing.T, reply func(req Req) interface{}) (*httptest.Server, *[]Req) {
+	t.Helper()
+	var requests []Req
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		if hr, ok := any(&req).(headerRecorder); ok {
+			hr.recordHeader(r.Header.Clone())
+		}
+		requests = append(requests, req)
+		json.NewEncoder(w).Encode(reply(req))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// generated returns the body of an Ollama generate response with text.
+func generated(text string) interface{} {
+	return map[string]string{"response": text}
+}
+
+func TestClient_TranslateJSON(t *testing.T) {
+	srv, requests := fakeServer(t, func(req generateRequest) interface{} {
+		return generated(`{"translation": "Dijo \"hola\""}`)
+	})
+	c := NewClient(srv.URL, "test-model", WithOutputMode(OutputJSON))
+
+	translated, err := c.TranslateText(context.Background(), `He said "hi"`, "en", "es")
+	if err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	if translated != `Dijo "hola"` {
+		t.Errorf("Expected %q, got %q", `Dijo "hola"`, translated)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(*requests))
+	}
+	req := (*requests)[0]
+	if len(req.Format) == 0 {
+		t.Error("Expected a format schema in the request")
+	}
+	if !strings.Contains(req.Prompt, `{"text":"He said \"hi\""}`) {
+		t.Errorf("Expected the text JSON-encoded in the prompt, got %q", req.Prompt)
+	}
+}
+
+func TestClient_TranslateJSONFallback(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+	}{
+		{"not json", `Sure! {"translation": "Hola"}`},
+		{"missing field", `{"text": "Hola"}`},
+		{"unknown field", `{"translation": "Hola", "note": "informal"}`},
+		{"trailing data", `{"translation": "Hola"} {"translation": "Hola"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := fakeServer(t, func(req generateRequest) interface{} {
+				if len(req.Format) == 0 {
+					return generated("Hola")
+				}
+				return generated(tt.reply)
+			})
+			c := NewClient(srv.URL, "test-model", WithOutputMode(OutputJSON))
+
+			translated, err := c.TranslateText(context.Background(), "Hello", "en", "es")
+			if err != nil {
+				t.Fatalf("TranslateText failed: %v", err)
+			}
+			if translated != "Hola" {
+				t.Errorf("Expected %q, got %q", "Hola", translated)
+			}
+			// One structured request, then one plain-text request.
+			if len(*requests) != 2 {
+				t.Errorf("Expected 2 requests, got %d", len(*requests))
+			}
+		})
+	}
+}
+
+func TestClient_TranslateBatchJSON(t *testing.T) {
+	srv, _ := fakeServer(t, func(req generateRequest) interface{} {
+		var schema struct {
+			Properties struct {
+				Translations struct {
+					MinItems int `json:"minItems"`
+				} `json:"translations"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(req.Format, &schema); err != nil || schema.Properties.Translations.MinItems != 2 {
+			t.Errorf("Expected a schema for 2 translations, got %s", req.Format)
+		}
+		return generated(`{"translations": ["Uno", "Dos"]}`)
+	})
+	c := NewClient(srv.URL, "test-model", WithOutputMode(OutputJSON))
+
+	translated, err := c.TranslateBatch(context.Background(), []string{"One", "Two"}, "en", "es")
+	if err != nil {
+		t.Fatalf("TranslateBatch failed: %v", err)
+	}
+	if !reflect.DeepEqual(translated, []string{"Uno", "Dos"}) {
+		t.Errorf("Expected [Uno Dos], got %q", translated)
+	}
+}
+
+func TestClient_TranslateJSONGlossary(t *testing.T) {
+	srv, requests := fakeServer(t, func(req generateRequest) interface{} {
+		if strings.Contains(req.Prompt, `"texts"`) {
+			return generated(`{"translations": ["Índice de calor alto", "Uno"]}`)
+		}
+		return generated(`{"translation": "Índice de calor alto"}`)
+	})
+	c := NewClient(srv.URL, "test-model", WithOutputMode(OutputJSON))
+
+	ctx := prompt.WithHints(context.Background(), prompt.Hints{
+		Glossary: []prompt.Term{{Source: "Heat index", Target: "Índice de calor"}},
+	})
+	if _, err := c.TranslateText(ctx, "High heat index", "en", "es"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	if _, err := c.TranslateBatch(ctx, []string{"High heat index", "One"}, "en", "es"); err != nil {
+		t.Fatalf("TranslateBatch failed: %v", err)
+	}
+	for _, req := range *requests {
+		if !strings.Contains(req.Prompt, `"Heat index" as "Índice de calor"`) {
+			t.Errorf("Expected the glossary in the JSON prompt, got %q", req.Prompt)
+		}
+	}
+	if n := len(*requests); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
+
+func TestGenerateJSON_SchemaError(t *testing.T) {
+	srv, _ := fakeServer(t, func(req generateRequest) interface{} {
+		return generated(`{"translations": ["Uno"]}`)
+	})
+	c := NewClient(srv.URL, "test-model", WithOutputMode(OutputJSON))
+
+	_, err := c.translateBatchJSON(context.Background(), []string{"One", "Two"}, "en", "es")
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("Expected a SchemaError, got %v", err)
+	}
+	if schemaErr.Reply != `{"translations": ["Uno"]}` {
+		t.Errorf("Expected the reply in the error, got %q", schemaErr.Reply)
+	}
+}
+
+func TestClient_PromptNamesLanguages(t *testing.T) {
+	srv, requests := fakeServer(t, func(req generateRequest) interface{} {
+		return generated("Olá")
+	})
+	c := NewClient(srv.URL, "test-model")
+
+	if _, err := c.TranslateText(context.Background(), "Hello", "en", "pt_br"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	prompt := (*requests)[0].Prompt
+	if !strings.Contains(prompt, "English") || !strings.Contains(prompt, "Portuguese (Brazil)") {
+		t.Errorf("Expected the language names in the prompt, got %q", prompt)
+	}
+}
+
+func TestClient_PromptTemplate(t *testing.T) {
+	srv, requests := fakeServer(t, func(req generateRequest) interface{} {
+		return generated("Principalement ensoleillé")
+	})
+	c := NewClient(srv.URL, "llama3.1:8b")
+	if name, hash := c.PromptTemplate(); name != "instruct" || hash == "" {
+		t.Errorf("Expected the instruct template, got %q %q", name, hash)
+	}
+
+	ctx := prompt.WithHints(context.Background(), prompt.Hints{Context: "Tonight"})
+	if _, err := c.TranslateText(ctx, "Mostly sunny", "en", "fr"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	req := (*requests)[0]
+	if req.Prompt != "Mostly sunny" {
+		t.Errorf("Expected the bare text as prompt, got %q", req.Prompt)
+	}
+	if !strings.Contains(req.System, "to French") || !strings.Contains(req.System, "Tonight") {
+		t.Errorf("Expected the languages and context in the system prompt, got %q", req.System)
+	}
+}
+
+func TestClient_TranslateJSONTemplate(t *testing.T) {
+	srv, requests := fakeServer(t, func(req generateRequest) interface{} {
+		return generated(`{"translation": "Principalement ensoleillé"}`)
+	})
+	c := NewClient(srv.URL, "llama3.1:8b", WithOutputMode(OutputJSON))
+
+	ctx := prompt.WithHints(context.Background(), prompt.Hints{Context: "Tonight"})
+	if _, err := c.TranslateText(ctx, "Mostly sunny", "en", "fr"); err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	req := (*requests)[0]
+	if !strings.Contains(req.System, "to French") || !strings.Contains(req.System, "Tonight") {
+		t.Errorf("Expected the template's system prompt with the context, got %q", req.System)
+	}
+	if !strings.Contains(req.Prompt, `{"text":"Mostly sunny"}`) {
+		t.Errorf("Expected the text JSON-encoded in the prompt, got %q", req.Prompt)
+	}
+}
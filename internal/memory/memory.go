@@ -0,0 +1,298 @@
+// Package memory implements a persistent translation memory: translations
+// returned by the model and accepted by the translator are stored on local
+// disk and served again for the same text, language pair, model and prompt,
+// without calling the model.
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
+)
+
+// bucket holds the translation memory entries.
+var bucket = []byte("translations")
+
+// Key identifies a translation in the memory.
+type Key struct {
+	Source        string
+	SourceLang    string
+	TargetLang    string
+	Model         string
+	PromptVersion string
+}
+
+// normalize returns the key with whitespace runs in the source collapsed
+// and language tags lowercased, so that trivially different requests share
+// an entry.
+func (k Key) normalize() Key {
+	k.Source = strings.Join(strings.Fields(k.Source), " ")
+	k.SourceLang = normalizeLang(k.SourceLang)
+	k.TargetLang = normalizeLang(k.TargetLang)
+	return k
+}
+
+func normalizeLang(tag string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), "_", "-")
+}
+
+// id returns the database key of k.
+func (k Key) id() []byte {
+	k = k.normalize()
+	h := sha256.New()
+	for _, f := range []string{k.SourceLang, k.TargetLang, k.Model, k.PromptVersion, k.Source} {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
+
+// entry is a stored translation.
+type entry struct {
+	Source      string    `json:"source"`
+	Translation string    `json:"translation"`
+	Created     time.Time `json:"created"`
+}
+
+// Store is a translation memory backed by a single file on local disk.
+// It is safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the translation memory at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open translation memory: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize translation memory: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the stored translation for k.
+func (s *Store) Get(k Key) (string, bool, error) {
+	var e entry
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucket).Get(k.id())
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		// Guard against hash collisions.
+		found = e.Source == k.normalize().Source
+		return nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read translation memory: %w", err)
+	}
+	return e.Translation, found, nil
+}
+
+// Put stores translation as the translation for k, replacing any previous
+// one.
+func (s *Store) Put(k Key, translation string) error {
+	v, err := json.Marshal(entry{
+		Source:      k.normalize().Source,
+		Translation: translation,
+		Created:     time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode translation memory entry: %w", err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(k.id(), v)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write translation memory: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of stored translations.
+func (s *Store) Len() (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// promptVersioner is implemented by LLM clients whose prompt is versioned;
+// translations made with another prompt version are not reused.
+type promptVersioner interface {
+	PromptVersion() string
+}
+
+// Client wraps a translator.LLMClient with a translation memory. Lookups
+// follow the translator.MemoryPolicy of the request and are reported with
+// translator.RecordMemoryLookup.
+type Client struct {
+	next  translator.LLMClient
+	store *Store
+}
+
+// NewClient returns next wrapped with the translation memory in store.
+func NewClient(next translator.LLMClient, store *Store) *Client {
+	return &Client{next: next, store: store}
+}
+
+// GetModelName returns the model name of the wrapped client.
+func (c *Client) GetModelName() string {
+	return c.next.GetModelName()
+}
+
+// PromptVersion returns the prompt version of the wrapped client, if any.
+func (c *Client) PromptVersion() string {
+	if pv, ok := c.next.(promptVersioner); ok {
+		return pv.PromptVersion()
+	}
+	return ""
+}
+
+// PromptTemplate returns the prompt template of the wrapped client, if any.
+func (c *Client) PromptTemplate() (name, hash string) {
+	if pt, ok := c.next.(translator.PromptTemplater); ok {
+		return pt.PromptTemplate()
+	}
+	return "", ""
+}
+
+// TranslateText returns the stored translation of text if there is one, and
+// otherwise translates it with the wrapped client and stores the result once
+// the translator accepts it (see translator.KeepOnAccept). Errors reading or
+// writing the memory are logged and do not fail the translation.
+func (c *Client) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	policy := translator.MemoryPolicyFromContext(ctx)
+	if policy == translator.MemoryBypass {
+		return c.next.TranslateText(ctx, text, sourceLang, targetLang)
+	}
+
+	k := c.key(text, sourceLang, targetLang)
+	if translated, ok := c.lookup(ctx, policy, k); ok {
+		return translated, nil
+	}
+	translated, err := c.next.TranslateText(ctx, text, sourceLang, targetLang)
+	if err != nil {
+		return "", err
+	}
+	c.keep(ctx, k, translated)
+	return translated, nil
+}
+
+// BatchTokenBudget returns the batch token budget of the wrapped client, or
+// 0 if it cannot batch.
+func (c *Client) BatchTokenBudget() int {
+	if bt, ok := c.next.(translator.BatchTranslator); ok {
+		return bt.BatchTokenBudget()
+	}
+	return 0
+}
+
+// TranslateBatch serves the texts found in the memory and sends the others
+// to the wrapped client as one batch. If that batch fails, its error is
+// returned: the translator then translates the segments one by one.
+func (c *Client) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	bt, ok := c.next.(translator.BatchTranslator)
+	if !ok {
+		return nil, errors.New("wrapped LLM client does not translate batches")
+	}
+	policy := translator.MemoryPolicyFromContext(ctx)
+	if policy == translator.MemoryBypass {
+		return bt.TranslateBatch(ctx, texts, sourceLang, targetLang)
+	}
+
+	translations := make([]string, len(texts))
+	var missing []int
+	var missingTexts []string
+	for i, text := range texts {
+		if translated, ok := c.lookup(ctx, policy, c.key(text, sourceLang, targetLang)); ok {
+			translations[i] = translated
+			continue
+		}
+		missing = append(missing, i)
+		missingTexts = append(missingTexts, text)
+	}
+	if len(missing) == 0 {
+		return translations, nil
+	}
+
+	translated, err := bt.TranslateBatch(ctx, missingTexts, sourceLang, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	if len(translated) != len(missing) {
+		return nil, fmt.Errorf("got %d translations for %d texts", len(translated), len(missing))
+	}
+	for i, t := range translated {
+		translations[missing[i]] = t
+		c.keep(ctx, c.key(missingTexts[i], sourceLang, targetLang), t)
+	}
+	return translations, nil
+}
+
+// key returns the memory key of a translation by the wrapped client.
+func (c *Client) key(text, sourceLang, targetLang string) Key {
+	return Key{
+		Source:        text,
+		SourceLang:    sourceLang,
+		TargetLang:    targetLang,
+		Model:         c.next.GetModelName(),
+		PromptVersion: c.PromptVersion(),
+	}
+}
+
+// lookup returns the stored translation for k under policy, and records
+// the lookup. A refresh counts as a miss: the model is called either way.
+func (c *Client) lookup(ctx context.Context, policy translator.MemoryPolicy, k Key) (string, bool) {
+	if policy == translator.MemoryUse {
+		translated, ok, err := c.store.Get(k)
+		if err != nil {
+			log.Printf("Translation memory lookup failed: %v", err)
+		}
+		if ok {
+			translator.RecordMemoryLookup(ctx, true)
+			return translated, true
+		}
+	}
+	translator.RecordMemoryLookup(ctx, false)
+	return "", false
+}
+
+// keep stores translated as the translation for k once the translator
+// accepts it.
+func (c *Client) keep(ctx context.Context, k Key, translated string) {
+	translator.KeepOnAccept(ctx, k.Source, func() { c.store.put(k, translated) })
+}
+
+// put stores a translation, logging failures.
+func (s *Store) put(k Key, translation string) {
+	if err := s.Put(k, translation); err != nil {
+		log.Printf("Translation memory update failed: %v", err)
+	}
+}
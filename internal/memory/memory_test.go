@@ -0,0 +1,265 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/translator"
+)
+
+// countingLLM counts the calls that reach the model.
+type countingLLM struct {
+	model   string
+	version string
+	calls   atomic.Int64
+}
+
+func (m *countingLLM) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	m.calls.Add(1)
+	return "TR:" + text, nil
+}
+
+func (m *countingLLM) GetModelName() string {
+	return m.model
+}
+
+func (m *countingLLM) PromptVersion() string {
+	return m.version
+}
+
+func openStore(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore_Key(t *testing.T) {
+	store := openStore(t, filepath.Join(t.TempDir(), "tm.db"))
+
+	k := Key{Source: "Partly  cloudy", SourceLang: "en", TargetLang: "pt_BR", Model: "m", PromptVersion: "1"}
+	if err := store.Put(k, "Parcialmente nublado"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  Key
+		want bool
+	}{
+		{"same", k, true},
+		{"normalized", Key{Source: "Partly cloudy\n", SourceLang: "EN", TargetLang: "pt-br", Model: "m", PromptVersion: "1"}, true},
+		{"other target", Key{Source: "Partly cloudy", SourceLang: "en", TargetLang: "pt", Model: "m", PromptVersion: "1"}, false},
+		{"other model", Key{Source: "Partly cloudy", SourceLang: "en", TargetLang: "pt-br", Model: "n", PromptVersion: "1"}, false},
+		{"other prompt", Key{Source: "Partly cloudy", SourceLang: "en", TargetLang: "pt-br", Model: "m", PromptVersion: "2"}, false},
+		{"other text", Key{Source: "Partly sunny", SourceLang: "en", TargetLang: "pt-br", Model: "m", PromptVersion: "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := store.Get(tt.key)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if ok != tt.want {
+				t.Fatalf("Expected found=%v, got %v", tt.want, ok)
+			}
+			if ok && got != "Parcialmente nublado" {
+				t.Errorf("Expected stored translation, got %q", got)
+			}
+		})
+	}
+}
+
+func TestClient_Translate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm.db")
+	llm := &countingLLM{model: "test-model", version: "1"}
+	store := openStore(t, path)
+	service := translator.NewService(NewClient(llm, store))
+
+	input := `<div><p>Rain likely.</p><p>Breezy.</p><p>Rain likely.</p></div>`
+	expected := `<html lang="es"><head></head><body><div><p>TR:Rain likely.</p><p>TR:Breezy.</p><p>TR:Rain likely.</p></div></body></html>`
+
+	translate := func(opts ...translator.Option) translator.MemoryStats {
+		t.Helper()
+		translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", opts...)
+		if err != nil {
+			t.Fatalf("Translate failed: %v", err)
+		}
+		if translated != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, translated)
+		}
+		if metadata.Memory == nil {
+			return translator.MemoryStats{}
+		}
+		return *metadata.Memory
+	}
+
+	// The repeated sentence is translated once per document, so it is
+	// looked up once.
+	if got := translate(); got != (translator.MemoryStats{Misses: 2}) {
+		t.Errorf("Expected 2 misses, got %+v", got)
+	}
+	calls := llm.calls.Load()
+
+	if got := translate(); got != (translator.MemoryStats{Hits: 2}) {
+		t.Errorf("Expected 2 hits, got %+v", got)
+	}
+	if llm.calls.Load() != calls {
+		t.Errorf("Expected no model calls on a second pass, got %d", llm.calls.Load()-calls)
+	}
+
+	if got := translate(translator.WithMemoryPolicy(translator.MemoryBypass)); got != (translator.MemoryStats{}) {
+		t.Errorf("Expected no lookups when bypassing, got %+v", got)
+	}
+	if got := translate(translator.WithMemoryPolicy(translator.MemoryRefresh)); got != (translator.MemoryStats{Misses: 2}) {
+		t.Errorf("Expected 2 misses when refreshing, got %+v", got)
+	}
+	if llm.calls.Load() != calls+4 {
+		t.Errorf("Expected bypass and refresh to call the model 4 times, got %d", llm.calls.Load()-calls)
+	}
+
+	// Entries survive reopening, but not a prompt change.
+	store.Close()
+	store = openStore(t, path)
+	if n, err := store.Len(); err != nil || n != 2 {
+		t.Errorf("Expected 2 stored translations, got %d (%v)", n, err)
+	}
+	llm.version = "2"
+	service = translator.NewService(NewClient(llm, store))
+	if got := translate(); got.Misses < 2 {
+		t.Errorf("Expected misses after a prompt change, got %+v", got)
+	}
+}
+
+// batchingLLM is a countingLLM that also translates batches.
+type batchingLLM struct {
+	countingLLM
+	batches atomic.Int64
+}
+
+func (m *batchingLLM) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	m.batches.Add(1)
+	out := make([]string, len(texts))
+	for i, text := range texts {
+		out[i] = "TR:" + text
+	}
+	return out, nil
+}
+
+func (m *batchingLLM) BatchTokenBudget() int {
+	return 100
+}
+
+func TestClient_TranslateBatch(t *testing.T) {
+	llm := &batchingLLM{countingLLM: countingLLM{model: "test-model"}}
+	store := openStore(t, filepath.Join(t.TempDir(), "tm.db"))
+	service := translator.NewService(NewClient(llm, store), translator.WithBatching(0))
+
+	translate := func(input string) translator.MemoryStats {
+		t.Helper()
+		_, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", translator.WithFragment("body"))
+		if err != nil {
+			t.Fatalf("Translate failed: %v", err)
+		}
+		return *metadata.Memory
+	}
+
+	if got := translate(`<p>One</p><p>Two</p>`); got != (translator.MemoryStats{Misses: 2}) {
+		t.Errorf("Expected 2 misses, got %+v", got)
+	}
+	// Only the new text is sent to the model.
+	if got := translate(`<p>One</p><p>Two</p><p>Three</p>`); got != (translator.MemoryStats{Hits: 2, Misses: 1}) {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", got)
+	}
+	if got := translate(`<p>Three</p><p>One</p>`); got != (translator.MemoryStats{Hits: 2}) {
+		t.Errorf("Expected 2 hits, got %+v", got)
+	}
+	if llm.batches.Load() != 2 || llm.calls.Load() != 0 {
+		t.Errorf("Expected 2 batches and no single calls, got %d and %d", llm.batches.Load(), llm.calls.Load())
+	}
+}
+
+// failingBatchLLM is a batchingLLM whose batches fail.
+type failingBatchLLM struct {
+	batchingLLM
+}
+
+func (m *failingBatchLLM) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	m.batches.Add(1)
+	return nil, errors.New("batch failed")
+}
+
+func TestClient_TranslateBatchFails(t *testing.T) {
+	llm := &failingBatchLLM{batchingLLM{countingLLM: countingLLM{model: "test-model"}}}
+	store := openStore(t, filepath.Join(t.TempDir(), "tm.db"))
+	service := translator.NewService(NewClient(llm, store), translator.WithBatching(0))
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(`<p>One</p><p>Two</p>`), "en", "es", translator.WithFragment("body"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != `<p>TR:One</p><p>TR:Two</p>` {
+		t.Errorf("Unexpected translation %q", translated)
+	}
+	// The translator's fallback sends each text once.
+	if llm.batches.Load() != 1 || llm.calls.Load() != 2 {
+		t.Errorf("Expected 1 batch and 2 single calls, got %d and %d", llm.batches.Load(), llm.calls.Load())
+	}
+}
+
+// refusingLLM refuses to translate until refused is cleared.
+type refusingLLM struct {
+	countingLLM
+	refused atomic.Bool
+}
+
+func (m *refusingLLM) TranslateText(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+	m.calls.Add(1)
+	if m.refused.Load() {
+		return "I cannot translate \"" + text + "\".", nil
+	}
+	return "TR:" + text, nil
+}
+
+func TestClient_KeepsAcceptedOnly(t *testing.T) {
+	llm := &refusingLLM{countingLLM: countingLLM{model: "test-model"}}
+	llm.refused.Store(true)
+	store := openStore(t, filepath.Join(t.TempDir(), "tm.db"))
+	service := translator.NewService(NewClient(llm, store))
+
+	translate := func() (string, translator.Metadata) {
+		t.Helper()
+		translated, metadata, err := service.Translate(context.Background(), strings.NewReader(`<p>Windy.</p>`), "en", "es", translator.WithFragment("body"))
+		if err != nil {
+			t.Fatalf("Translate failed: %v", err)
+		}
+		return translated, metadata
+	}
+
+	// The refusal is rejected, retried with a fresh translation, and
+	// rejected again; it is not stored.
+	if translated, metadata := translate(); translated != `<p>Windy.</p>` || metadata.Rejected != 1 {
+		t.Errorf("Expected the segment rejected, got %q (%d rejected)", translated, metadata.Rejected)
+	}
+	if n := llm.calls.Load(); n != 2 {
+		t.Errorf("Expected 2 model calls, got %d", n)
+	}
+	if n, err := store.Len(); err != nil || n != 0 {
+		t.Errorf("Expected no stored translations, got %d (%v)", n, err)
+	}
+
+	llm.refused.Store(false)
+	if translated, _ := translate(); translated != `<p>TR:Windy.</p>` {
+		t.Errorf("Expected the segment translated, got %q", translated)
+	}
+	if translated, metadata := translate(); translated != `<p>TR:Windy.</p>` || *metadata.Memory != (translator.MemoryStats{Hits: 1}) {
+		t.Errorf("Expected the accepted translation served from memory, got %q (%+v)", translated, metadata.Memory)
+	}
+}
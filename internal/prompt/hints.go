@@ -0,0 +1,41 @@
+package prompt
+
+import "context"
+
+// Hints are the per-request material templates may add to a prompt beyond
+// the text itself.
+type Hints struct {
+	// Context is the text surrounding the text to translate in its
+	// document, to resolve ambiguities. It is not to be translated.
+	Context string
+	// Glossary lists mandated translations of terms in the text.
+	Glossary []Term
+	// Examples are reference translations of similar texts.
+	Examples []Example
+}
+
+// Term is a glossary entry.
+type Term struct {
+	Source string
+	Target string
+}
+
+// Example is a reference translation.
+type Example struct {
+	Source string
+	Target string
+}
+
+// hintsKey is the context key of the Hints of a request.
+type hintsKey struct{}
+
+// WithHints returns ctx carrying h to the LLM client.
+func WithHints(ctx context.Context, h Hints) context.Context {
+	return context.WithValue(ctx, hintsKey{}, h)
+}
+
+// HintsFromContext returns the Hints carried by ctx, if any.
+func HintsFromContext(ctx context.Context) Hints {
+	h, _ := ctx.Value(hintsKey{}).(Hints)
+	return h
+}
@@ -0,0 +1,285 @@
+// Package prompt builds the prompts sent to the model from text/template
+// files. Each model family gets the template whose match pattern fits its
+// name best, so that models with their own prompt format, such as
+// translategemma, are addressed the way they were trained.
+//
+// A template file defines these templates:
+//
+//	match   a regular expression matched, case-insensitively, against the
+//	        model name; the default template, default.tmpl, has none
+//	system  the system prompt (optional)
+//	prompt  the prompt translating .Text
+//	batch   the prompt translating the numbered .Texts
+//	json    the prompt translating .Text, given as the JSON object .JSON,
+//	        for replies constrained to a JSON schema
+//	json-batch
+//	        the prompt translating .Texts, given as the JSON object .JSON,
+//	        for replies constrained to a JSON schema
+//
+// Every file is parsed on top of the default template and inherits the
+// definitions it does not override. They are executed with a Vars.
+package prompt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// DefaultName is the name of the template used for models no other
+// template matches.
+const DefaultName = "default"
+
+// Vars are the variables available to templates.
+type Vars struct {
+	// SourceLang and TargetLang are the English names of the languages,
+	// e.g. "Portuguese (Brazil)".
+	SourceLang string
+	TargetLang string
+	// SourceTag and TargetTag are their BCP 47 tags, e.g. "pt-BR".
+	SourceTag string
+	TargetTag string
+	// Text is the text to translate, for the prompt template.
+	Text string
+	// Texts are the texts to translate, for the batch template.
+	Texts []string
+	// JSON holds .Text, or .Texts, as a JSON object, for the json and
+	// json-batch templates.
+	JSON string
+	// Placeholders is set when the text contains inline markup
+	// placeholders such as <g1>...</g1> or <x1/>.
+	Placeholders bool
+	Hints
+}
+
+// Template is a parsed template file.
+type Template struct {
+	// Name is the file name without its ".tmpl" extension.
+	Name string
+	// Hash identifies the template's source, so that results can be
+	// traced to the exact prompt that produced them.
+	Hash  string
+	match *regexp.Regexp
+	tmpl  *template.Template
+}
+
+// System renders the system prompt, or returns "" if the template has none.
+func (t *Template) System(v Vars) (string, error) {
+	if t.tmpl.Lookup("system") == nil {
+		return "", nil
+	}
+	return t.execute("system", v)
+}
+
+// Prompt renders the prompt translating v.Text.
+func (t *Template) Prompt(v Vars) (string, error) {
+	return t.execute("prompt", v)
+}
+
+// Batch renders the prompt translating v.Texts.
+func (t *Template) Batch(v Vars) (string, error) {
+	return t.execute("batch", v)
+}
+
+// JSON renders the prompt translating v.Text, given as v.JSON, for a reply
+// constrained to a JSON schema.
+func (t *Template) JSON(v Vars) (string, error) {
+	return t.execute("json", v)
+}
+
+// JSONBatch renders the prompt translating v.Texts, given as v.JSON, for a
+// reply constrained to a JSON schema.
+func (t *Template) JSONBatch(v Vars) (string, error) {
+	return t.execute("json-batch", v)
+}
+
+func (t *Template) execute(name string, v Vars) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&buf, name, v); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", t.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// funcs are the functions available to templates.
+var funcs = template.FuncMap{
+	// numbered lists texts one per line, each after its [[n]] marker, as
+	// batch replies are expected to number them.
+	"numbered": func(texts []string) string {
+		var b strings.Builder
+		for i, text := range texts {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "[[%d]] %s", i+1, text)
+		}
+		return b.String()
+	},
+}
+
+// Set is a set of templates.
+type Set struct {
+	templates map[string]*Template
+}
+
+// defaults is the set of embedded templates.
+var defaults = mustLoad()
+
+func mustLoad() *Set {
+	s, err := Load("")
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Defaults returns the embedded templates.
+func Defaults() *Set {
+	return defaults
+}
+
+// Load returns the embedded templates along with the *.tmpl files in dir,
+// which replace embedded templates of the same name. An empty dir loads
+// only the embedded templates.
+func Load(dir string) (*Set, error) {
+	sources := make(map[string][]byte)
+	if err := readDir(sources, embedded, "templates"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("failed to read prompt templates: %w", err)
+		}
+		if err := readDir(sources, os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	def, ok := sources[DefaultName]
+	if !ok {
+		return nil, fmt.Errorf("no %s prompt template", DefaultName)
+	}
+
+	s := &Set{templates: make(map[string]*Template)}
+	for name, src := range sources {
+		t, err := parse(name, src, def)
+		if err != nil {
+			return nil, err
+		}
+		s.templates[name] = t
+	}
+	return s, nil
+}
+
+// readDir reads the *.tmpl files of dir in fsys into sources, by name.
+func readDir(sources map[string][]byte, fsys fs.FS, dir string) error {
+	paths, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.tmpl")))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		src, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		sources[strings.TrimSuffix(filepath.Base(p), ".tmpl")] = src
+	}
+	return nil
+}
+
+// parse parses the template file name with source src on top of def, the
+// source of the default template, whose definitions it inherits unless it
+// overrides them.
+func parse(name string, src, def []byte) (*Template, error) {
+	tmpl := template.New(name).Funcs(funcs)
+	h := sha256.New()
+	if name != DefaultName {
+		if _, err := tmpl.Parse(string(def)); err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template %s: %w", DefaultName, err)
+		}
+		h.Write(def)
+		h.Write([]byte{0})
+	}
+	if _, err := tmpl.Parse(string(src)); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+	h.Write(src)
+	t := &Template{Name: name, Hash: hex.EncodeToString(h.Sum(nil))[:16], tmpl: tmpl}
+
+	if tmpl.Lookup("match") != nil {
+		if name == DefaultName {
+			return nil, fmt.Errorf("prompt template %s must not define \"match\"", name)
+		}
+		pattern, err := t.execute("match", Vars{})
+		if err != nil {
+			return nil, err
+		}
+		t.match, err = regexp.Compile("(?i)" + strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid match pattern in prompt template %s: %w", name, err)
+		}
+	}
+
+	// Render every template once so that mistakes such as misspelled
+	// variables are reported on load rather than on the first request.
+	for _, part := range []string{"prompt", "batch", "json", "json-batch"} {
+		if tmpl.Lookup(part) == nil {
+			return nil, fmt.Errorf("prompt template %s does not define %q", name, part)
+		}
+	}
+	sample := Vars{
+		SourceLang: "English", TargetLang: "Spanish", SourceTag: "en", TargetTag: "es",
+		Text: "Hello", Texts: []string{"Hello", "World"}, JSON: `{"text":"Hello"}`, Placeholders: true,
+		Hints: Hints{
+			Context:  "Hello World",
+			Glossary: []Term{{Source: "World", Target: "Mundo"}},
+			Examples: []Example{{Source: "Good morning", Target: "Buenos días"}},
+		},
+	}
+	for _, render := range []func(Vars) (string, error){t.System, t.Prompt, t.Batch, t.JSON, t.JSONBatch} {
+		if _, err := render(sample); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Select returns the template for model: among the templates whose match
+// pattern matches the model name, the one matching the longest part of it
+// wins, so that "translategemma" takes precedence over "gemma". Ties go to
+// the first name in lexical order. Models no template matches get the
+// default template.
+func (s *Set) Select(model string) *Template {
+	best, bestLen := s.templates[DefaultName], -1
+	for _, name := range s.Names() {
+		t := s.templates[name]
+		if t.match == nil {
+			continue
+		}
+		if loc := t.match.FindStringIndex(model); loc != nil && loc[1]-loc[0] > bestLen {
+			best, bestLen = t, loc[1]-loc[0]
+		}
+	}
+	return best
+}
+
+// Names returns the names of the templates in the set, sorted.
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
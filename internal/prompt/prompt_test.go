@@ -0,0 +1,173 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefault_Prompt(t *testing.T) {
+	tmpl := Defaults().Select("test-model")
+	if tmpl.Name != DefaultName {
+		t.Fatalf("Expected the default template, got %s", tmpl.Name)
+	}
+	v := Vars{SourceLang: "English", TargetLang: "Spanish", SourceTag: "en", TargetTag: "es"}
+
+	v.Text = "Hello"
+	got, err := tmpl.Prompt(v)
+	if err != nil {
+		t.Fatalf("Prompt failed: %v", err)
+	}
+	if want := `Translate the English text "Hello" to Spanish. return only the translated string.`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	v.Text, v.Placeholders = "<g1>Hello</g1>", true
+	v.Glossary = []Term{{Source: "Hello", Target: "Hola"}, {Source: "NWS", Target: "NWS"}}
+	got, err = tmpl.Prompt(v)
+	if err != nil {
+		t.Fatalf("Prompt failed: %v", err)
+	}
+	want := `Translate the English text "<g1>Hello</g1>" to Spanish. return only the translated string.` +
+		` Keep the tags <g1>, </g1>, <x1/> and similar exactly as they are, around the words they belong to.` +
+		` Translate these terms as given: "Hello" as "Hola"; "NWS" as "NWS".`
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	system, err := tmpl.System(v)
+	if err != nil || system != "" {
+		t.Errorf("Expected no system prompt, got %q, %v", system, err)
+	}
+}
+
+func TestDefault_Batch(t *testing.T) {
+	v := Vars{SourceLang: "English", TargetLang: "Spanish", Texts: []string{"One", "Two"}}
+	got, err := Defaults().Select("test-model").Batch(v)
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	want := "Translate each of the following 2 numbered English texts to Spanish. " +
+		"Return only the translations, in the same order, each on a new line starting with its number exactly as given ([[1]], [[2]], ...).\n" +
+		"\n[[1]] One\n[[2]] Two"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := map[string]string{
+		"google/translategemma-4b-it": "translategemma",
+		"TranslateGemma:12b":          "translategemma",
+		"gemma2:9b":                   "instruct",
+		"llama3.1:8b-instruct-q4_K_M": "instruct",
+		"qwen2.5:7b":                  "instruct",
+		"test-model":                  DefaultName,
+	}
+	for model, want := range tests {
+		if got := Defaults().Select(model).Name; got != want {
+			t.Errorf("Select(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestInstruct(t *testing.T) {
+	tmpl := Defaults().Select("llama3")
+	v := Vars{
+		SourceLang: "English", TargetLang: "French", Text: "Mostly sunny",
+		Hints: Hints{Context: "Tonight\nClear, with a low around 68."},
+	}
+	system, err := tmpl.System(v)
+	if err != nil {
+		t.Fatalf("System failed: %v", err)
+	}
+	if !strings.Contains(system, "from English to French") || !strings.Contains(system, "Clear, with a low around 68.") {
+		t.Errorf("Expected the languages and context in the system prompt, got %q", system)
+	}
+	if got, _ := tmpl.Prompt(v); got != "Mostly sunny" {
+		t.Errorf("Expected the bare text as prompt, got %q", got)
+	}
+}
+
+func TestTranslateGemma(t *testing.T) {
+	tmpl := Defaults().Select("translategemma")
+	v := Vars{SourceLang: "English", TargetLang: "Portuguese (Brazil)", SourceTag: "en", TargetTag: "pt-BR", Text: "Mostly sunny"}
+	got, err := tmpl.Prompt(v)
+	if err != nil {
+		t.Fatalf("Prompt failed: %v", err)
+	}
+	if !strings.HasPrefix(got, "You are a professional English (en) to Portuguese (Brazil) (pt-BR) translator.") {
+		t.Errorf("Unexpected prompt %q", got)
+	}
+	if !strings.HasSuffix(got, "into Portuguese (Brazil):\n\n\nMostly sunny") {
+		t.Errorf("Expected the text after two blank lines, got %q", got)
+	}
+	// translategemma does not define batch and inherits the default's.
+	batch, err := tmpl.Batch(Vars{SourceLang: "English", TargetLang: "Spanish", Texts: []string{"One", "Two"}})
+	if err != nil || !strings.HasSuffix(batch, "[[1]] One\n[[2]] Two") {
+		t.Errorf("Expected the default batch prompt, got %q, %v", batch, err)
+	}
+}
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"aya.tmpl":      `{{define "match"}}aya{{end}}{{define "prompt"}}{{.TargetTag}}: {{.Text}}{{end}}`,
+		"instruct.tmpl": `{{define "match"}}llama{{end}}{{define "prompt"}}Translate: {{.Text}}{{end}}`,
+		"notes.txt":     `not a template`,
+	})
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := strings.Join(set.Names(), ","); got != "aya,default,instruct,translategemma" {
+		t.Errorf("Unexpected templates %s", got)
+	}
+
+	aya := set.Select("aya-expanse:8b")
+	if got, _ := aya.Prompt(Vars{TargetTag: "de", Text: "Hi"}); got != "de: Hi" {
+		t.Errorf("Expected the aya prompt, got %q", got)
+	}
+	if _, err := aya.Batch(Vars{Texts: []string{"Hi"}}); err != nil {
+		t.Errorf("Expected the default batch prompt to be inherited: %v", err)
+	}
+
+	// The file replaces the embedded template of the same name.
+	if set.Select("qwen2.5").Name != DefaultName {
+		t.Error("Expected the replaced instruct template not to match qwen")
+	}
+	if set.Select("llama3").Hash == Defaults().Select("llama3").Hash {
+		t.Error("Expected the replaced template to have another hash")
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := map[string]map[string]string{
+		"syntax":        {"bad.tmpl": `{{define "prompt"}}{{.Text}{{end}}`},
+		"unknown field": {"bad.tmpl": `{{define "prompt"}}{{.Txet}}{{end}}`},
+		"bad pattern":   {"bad.tmpl": `{{define "match"}}(llama{{end}}`},
+		"default match": {"default.tmpl": `{{define "match"}}llama{{end}}{{define "prompt"}}{{.Text}}{{end}}{{define "batch"}}{{numbered .Texts}}{{end}}`},
+		"no batch":      {"default.tmpl": `{{define "prompt"}}{{.Text}}{{end}}`},
+	}
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(writeTemplates(t, files)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,248 @@
+package translator
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// An adaptive Scheduler tunes its limit to the model server (AIMD): while
+// all its slots are in use and the recent latency stays within
+// latencyTolerance of the baseline latency, it adds a slot for every limit
+// requests served. Latencies are compared per estimated token of the
+// requests, so that a run of long segments or full batches does not read as
+// a slower server. When the recent latency grows past that, it cuts the
+// limit by latencyBackoff, and when the server reports overload, by
+// overloadBackoff.
+const (
+	latencyTolerance = 1.5
+	latencyBackoff   = 0.9
+	overloadBackoff  = 0.5
+	// recentWeight is the weight of a request in the recent latency, a
+	// moving average over about ten requests.
+	recentWeight = 0.1
+	// baselineWeight is the weight of a request in the baseline latency:
+	// the lowest recent latency seen, drifting up towards the recent
+	// latency so that it follows lasting changes in the requests sent.
+	baselineWeight = 0.002
+	// latencyWindow is the number of requests the latency percentiles are
+	// computed over.
+	latencyWindow = 256
+	// requestOverhead is the number of tokens of text the prompt and the
+	// reply framing of a request cost about as much time as, so that short
+	// segments are not judged by their text alone.
+	requestOverhead = 32
+)
+
+// NewAdaptiveScheduler returns a Scheduler whose limit adapts to the
+// latency of the model server, starting at min concurrent requests and
+// growing up to max. It only adapts if the LLMClient reports its requests
+// with RecordLatency and RecordOverload.
+func NewAdaptiveScheduler(min, max int) *Scheduler {
+	s := NewScheduler(min)
+	if max < s.limit {
+		max = s.limit
+	}
+	s.adaptive = &aimd{min: s.limit, max: max, limit: float64(s.limit)}
+	return s
+}
+
+// aimd is the limit of an adaptive Scheduler.
+type aimd struct {
+	min, max int
+	// limit is the fractional limit slots are added to.
+	limit float64
+	// cooldown is the number of requests to observe before the limit may
+	// be cut again, so that the requests in flight when it was cut do not
+	// cut it further.
+	cooldown int
+}
+
+// decrease multiplies the limit by factor, unless it was cut recently.
+func (a *aimd) decrease(factor float64) {
+	if a.cooldown > 0 {
+		return
+	}
+	a.limit = math.Max(float64(a.min), a.limit*factor)
+	a.cooldown = int(a.limit)
+}
+
+// SchedulerStats reports the state of a Scheduler.
+type SchedulerStats struct {
+	// Adaptive is set if the limit adapts to the model server.
+	Adaptive bool `json:"adaptive"`
+	Limit    int  `json:"limit"`
+	MinLimit int  `json:"min_limit"`
+	MaxLimit int  `json:"max_limit"`
+	// Running is the number of model requests in flight and Waiting the
+	// number waiting for a slot.
+	Running int          `json:"running"`
+	Waiting int          `json:"waiting"`
+	Latency LatencyStats `json:"latency"`
+	// Overloads counts the requests the server refused or timed out for
+	// being overloaded.
+	Overloads int64 `json:"overloads"`
+}
+
+// LatencyStats reports the latency of successful model requests. Durations
+// are in nanoseconds.
+type LatencyStats struct {
+	Requests int64 `json:"requests"`
+	// Recent is the moving average latency per estimated token of the last
+	// ten or so requests, and Baseline the latency per token the limit
+	// adapts against. Both count requestOverhead tokens per request.
+	Recent   time.Duration `json:"recent"`
+	Baseline time.Duration `json:"baseline"`
+	// P50 and P95 are percentiles of the last latencyWindow requests.
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+}
+
+// latencyLog collects the latencies observed by a Scheduler.
+type latencyLog struct {
+	requests int64
+	// recent and baseline are latencies per token; window holds the
+	// latencies of whole requests.
+	recent, baseline float64
+	window           [latencyWindow]time.Duration
+	overloads        int64
+}
+
+// add records a request for about tokens tokens of text that took d.
+func (l *latencyLog) add(d time.Duration, tokens int) {
+	l.window[l.requests%latencyWindow] = d
+	l.requests++
+	perToken := float64(d) / float64(max(tokens, 0)+requestOverhead)
+	if l.requests == 1 {
+		l.recent, l.baseline = perToken, perToken
+		return
+	}
+	l.recent += (perToken - l.recent) * recentWeight
+	if l.recent < l.baseline {
+		l.baseline = l.recent
+	} else {
+		l.baseline += (l.recent - l.baseline) * baselineWeight
+	}
+}
+
+// stats returns the latency statistics.
+func (l *latencyLog) stats() LatencyStats {
+	st := LatencyStats{
+		Requests: l.requests,
+		Recent:   time.Duration(l.recent),
+		Baseline: time.Duration(l.baseline),
+	}
+	n := int(min(l.requests, latencyWindow))
+	if n == 0 {
+		return st
+	}
+	window := append([]time.Duration(nil), l.window[:n]...)
+	sort.Slice(window, func(a, b int) bool { return window[a] < window[b] })
+	st.P50 = window[(n-1)*50/100]
+	st.P95 = window[(n-1)*95/100]
+	return st
+}
+
+// observe records a successful model request for about tokens tokens of
+// text that took d, and adapts the limit.
+func (s *Scheduler) observe(d time.Duration, tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency.add(d, tokens)
+	a := s.adaptive
+	if a == nil {
+		return
+	}
+	if a.cooldown > 0 {
+		a.cooldown--
+	}
+	switch {
+	case s.latency.recent > latencyTolerance*s.latency.baseline:
+		a.decrease(latencyBackoff)
+	case s.running >= s.limit:
+		// Only a limit in use shows whether more requests slow the
+		// server down.
+		a.limit = math.Min(float64(a.max), a.limit+1/a.limit)
+	}
+	s.setLimit(int(a.limit))
+}
+
+// overload records a model request the server refused or timed out for
+// being overloaded, and cuts the limit.
+func (s *Scheduler) overload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency.overloads++
+	a := s.adaptive
+	if a == nil {
+		return
+	}
+	if a.cooldown > 0 {
+		a.cooldown--
+	}
+	a.decrease(overloadBackoff)
+	s.setLimit(int(a.limit))
+}
+
+// setLimit sets the limit, handing out the slots it adds.
+func (s *Scheduler) setLimit(limit int) {
+	s.limit = limit
+	s.dispatch()
+}
+
+// Stats returns the current limit, load and latencies of s.
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SchedulerStats{
+		Limit:     s.limit,
+		MinLimit:  s.limit,
+		MaxLimit:  s.limit,
+		Running:   s.running,
+		Waiting:   s.waiting(),
+		Latency:   s.latency.stats(),
+		Overloads: s.latency.overloads,
+	}
+	if a := s.adaptive; a != nil {
+		st.Adaptive = true
+		st.MinLimit, st.MaxLimit = a.min, a.max
+	}
+	return st
+}
+
+type (
+	schedulerKey   struct{}
+	requestSizeKey struct{}
+)
+
+// withSchedulerContext returns ctx reporting model requests to s.
+func withSchedulerContext(ctx context.Context, s *Scheduler) context.Context {
+	return context.WithValue(ctx, schedulerKey{}, s)
+}
+
+// withRequestSize returns ctx for a model request translating about tokens
+// tokens of text.
+func withRequestSize(ctx context.Context, tokens int) context.Context {
+	return context.WithValue(ctx, requestSizeKey{}, tokens)
+}
+
+// RecordLatency reports that a model request made for the Translate call
+// ctx was passed to succeeded after d. LLM clients call it for every
+// request they send, retries included, so that an adaptive Scheduler can
+// tune its limit to the server.
+func RecordLatency(ctx context.Context, d time.Duration) {
+	if s, ok := ctx.Value(schedulerKey{}).(*Scheduler); ok {
+		tokens, _ := ctx.Value(requestSizeKey{}).(int)
+		s.observe(d, tokens)
+	}
+}
+
+// RecordOverload reports that the server refused a model request made for
+// the Translate call ctx was passed to, or timed out, for being overloaded:
+// a 429 or 503 status or a request timeout.
+func RecordOverload(ctx context.Context) {
+	if s, ok := ctx.Value(schedulerKey{}).(*Scheduler); ok {
+		s.overload()
+	}
+}
@@ -0,0 +1,130 @@
+package translator
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// saturate acquires slots of s until all are in use.
+func saturate(t *testing.T, s *Scheduler, q *queue) {
+	t.Helper()
+	for st := s.Stats(); st.Running < st.Limit; st = s.Stats() {
+		if err := q.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScheduler_AdaptiveIncrease(t *testing.T) {
+	s := NewAdaptiveScheduler(2, 4)
+	q := s.newQueue(PriorityBatch)
+	for i := 0; i < 100; i++ {
+		saturate(t, s, q)
+		s.observe(100*time.Millisecond, 0)
+	}
+	if limit := s.Stats().Limit; limit != 4 {
+		t.Errorf("Expected the limit to grow to its maximum of 4 at flat latency, got %d", limit)
+	}
+}
+
+func TestScheduler_AdaptiveIdle(t *testing.T) {
+	s := NewAdaptiveScheduler(2, 4)
+	for i := 0; i < 100; i++ {
+		s.observe(100*time.Millisecond, 0)
+	}
+	if limit := s.Stats().Limit; limit != 2 {
+		t.Errorf("Expected the limit to stay at 2 while slots are free, got %d", limit)
+	}
+}
+
+func TestScheduler_AdaptiveLatencyGrowth(t *testing.T) {
+	s := NewAdaptiveScheduler(1, 20)
+	s.adaptive.limit, s.limit = 10, 10
+	for i := 0; i < 20; i++ {
+		s.observe(100*time.Millisecond, 0)
+	}
+	for i := 0; i < 3; i++ {
+		s.observe(500*time.Millisecond, 0)
+	}
+	if limit := s.Stats().Limit; limit != 9 {
+		t.Errorf("Expected the limit cut once to 9, got %d", limit)
+	}
+	for i := 0; i < 100; i++ {
+		s.observe(500*time.Millisecond, 0)
+	}
+	// Latency that does not recover takes the limit down to its minimum.
+	if limit := s.Stats().Limit; limit != 1 {
+		t.Errorf("Expected the limit cut to its minimum of 1, got %d", limit)
+	}
+}
+
+func TestScheduler_AdaptiveRequestSize(t *testing.T) {
+	s := NewAdaptiveScheduler(1, 20)
+	s.adaptive.limit, s.limit = 10, 10
+	// Short segments, then full batches, at the same speed per token.
+	for i := 0; i < 20; i++ {
+		s.observe(time.Duration(10+requestOverhead)*time.Millisecond, 10)
+	}
+	for i := 0; i < 20; i++ {
+		s.observe(time.Duration(500+requestOverhead)*time.Millisecond, 500)
+	}
+	if limit := s.Stats().Limit; limit != 10 {
+		t.Errorf("Expected larger requests to leave the limit at 10, got %d", limit)
+	}
+}
+
+func TestScheduler_AdaptiveOverload(t *testing.T) {
+	s := NewAdaptiveScheduler(3, 20)
+	s.adaptive.limit, s.limit = 8, 8
+	// Requests in flight fail together; only the first cuts the limit.
+	s.overload()
+	s.overload()
+	if limit := s.Stats().Limit; limit != 4 {
+		t.Errorf("Expected the limit halved to 4, got %d", limit)
+	}
+	for i := 0; i < 10; i++ {
+		s.overload()
+	}
+	st := s.Stats()
+	if st.Limit != 3 {
+		t.Errorf("Expected the limit to stop at its minimum of 3, got %d", st.Limit)
+	}
+	if st.Overloads != 12 {
+		t.Errorf("Expected 12 overloads, got %d", st.Overloads)
+	}
+}
+
+func TestScheduler_AdaptiveReleasesWaiters(t *testing.T) {
+	s := NewAdaptiveScheduler(1, 2)
+	q := s.newQueue(PriorityBatch)
+	saturate(t, s, q)
+
+	done := make(chan error)
+	go func() { done <- q.acquire(context.Background()) }()
+	for s.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	s.observe(100*time.Millisecond, 0)
+	if err := <-done; err != nil {
+		t.Errorf("Expected the added slot to go to the waiting request: %v", err)
+	}
+}
+
+func TestScheduler_LatencyStats(t *testing.T) {
+	s := NewScheduler(3)
+	for i := 1; i <= 100; i++ {
+		s.observe(time.Duration(i)*time.Millisecond, 0)
+	}
+	st := s.Stats()
+	if st.Adaptive || st.Limit != 3 {
+		t.Errorf("Expected a fixed limit of 3, got %+v", st)
+	}
+	if st.Latency.Requests != 100 || st.Latency.P50 != 50*time.Millisecond || st.Latency.P95 != 95*time.Millisecond {
+		t.Errorf("Unexpected latency stats %+v", st.Latency)
+	}
+	// The baseline only slowly follows the latency up.
+	if st.Latency.Baseline >= st.Latency.Recent/2 {
+		t.Errorf("Expected the baseline well below the recent latency %v, got %v", st.Latency.Recent, st.Latency.Baseline)
+	}
+}
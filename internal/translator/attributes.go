@@ -0,0 +1,146 @@
+package translator
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// AttributeRule selects a user-visible attribute whose value is translated
+// along with the text content of the document.
+type AttributeRule struct {
+	// Element is the element name, or "*" to match any element.
+	Element   string
+	Attribute string
+	// When optionally restricts the rule to elements carrying another
+	// attribute with one of a set of values, e.g. <meta name="description">.
+	When *AttributeCondition
+}
+
+// AttributeCondition requires attribute Key to have one of Values. A value
+// ending in "*" matches by prefix. Matching is case-insensitive.
+type AttributeCondition struct {
+	Key    string
+	Values []string
+}
+
+// AttributePolicy lists the attributes translated by the Service.
+type AttributePolicy []AttributeRule
+
+// DefaultAttributePolicy covers tooltips, accessible names, form hints and
+// the page descriptions used by search engines and social previews.
+var DefaultAttributePolicy = AttributePolicy{
+	{Element: "*", Attribute: "title"},
+	{Element: "*", Attribute: "aria-label"},
+	{Element: "*", Attribute: "aria-description"},
+	{Element: "*", Attribute: "aria-placeholder"},
+	{Element: "*", Attribute: "aria-roledescription"},
+	{Element: "img", Attribute: "alt"},
+	{Element: "area", Attribute: "alt"},
+	{Element: "input", Attribute: "alt"},
+	{Element: "input", Attribute: "placeholder"},
+	{Element: "textarea", Attribute: "placeholder"},
+	{Element: "input", Attribute: "value", When: &AttributeCondition{
+		Key:    "type",
+		Values: []string{"button", "submit", "reset"},
+	}},
+	{Element: "optgroup", Attribute: "label"},
+	{Element: "option", Attribute: "label"},
+	{Element: "track", Attribute: "label"},
+	{Element: "meta", Attribute: "content", When: &AttributeCondition{
+		Key:    "name",
+		Values: []string{"description", "keywords", "twitter:title", "twitter:description", "twitter:image:alt", "dc.title", "dc.description"},
+	}},
+	{Element: "meta", Attribute: "content", When: &AttributeCondition{
+		Key:    "property",
+		Values: []string{"og:title", "og:description", "og:site_name", "og:image:alt"},
+	}},
+}
+
+// matches reports whether the rule applies to attribute key of element n.
+func (r AttributeRule) matches(n *html.Node, key string) bool {
+	if r.Element != "*" && r.Element != n.Data {
+		return false
+	}
+	if r.Attribute != key {
+		return false
+	}
+	if r.When == nil {
+		return true
+	}
+	value, ok := attr(n, r.When.Key)
+	if !ok {
+		return false
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, v := range r.When.Values {
+		v = strings.ToLower(v)
+		if prefix, ok := strings.CutSuffix(v, "*"); ok {
+			if strings.HasPrefix(value, prefix) {
+				return true
+			}
+		} else if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// translates reports whether the policy covers attribute key of element n.
+func (p AttributePolicy) translates(n *html.Node, key string) bool {
+	for _, r := range p {
+		if r.matches(n, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectAttributeSegments returns a segment for every non-blank attribute
+// value in the document selected by policy, on elements not excluded from
+// translation.
+func collectAttributeSegments(doc *html.Node, policy AttributePolicy, skip []Selector) []*segment {
+	var segs []*segment
+	var walk func(n *html.Node, translate bool)
+	walk = func(n *html.Node, translate bool) {
+		if n.Type == html.ElementNode {
+			translate = translatable(n, translate, skip)
+			for i, a := range n.Attr {
+				if !translate || a.Namespace != "" || strings.TrimSpace(a.Val) == "" || !policy.translates(n, a.Key) {
+					continue
+				}
+				segs = append(segs, attributeSegment(n, i))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, translate)
+		}
+	}
+	for c := doc.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, true)
+	}
+	return segs
+}
+
+// attributeSegment translates the i-th attribute of n.
+func attributeSegment(n *html.Node, i int) *segment {
+	return &segment{
+		source: n.Attr[i].Val,
+		apply: func(translated string) error {
+			n.Attr[i].Val = translated
+			return nil
+		},
+		node: n,
+		attr: n.Attr[i].Key,
+	}
+}
+
+// attr returns the value of the attribute key of n.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
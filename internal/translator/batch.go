@@ -0,0 +1,122 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+)
+
+// BatchTranslator is implemented by LLM clients that can translate several
+// texts in a single model request.
+type BatchTranslator interface {
+	// TranslateBatch translates texts, returning exactly one translation
+	// per text, in order, or an error if the model's response could not be
+	// split back into them.
+	TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error)
+	// BatchTokenBudget returns how many source tokens the client packs into
+	// one request for its model, or 0 if it cannot batch.
+	BatchTokenBudget() int
+}
+
+// maxBatchSegments caps the number of segments in a batch, however short:
+// models lose track of long numbered lists.
+const maxBatchSegments = 32
+
+// estimateTokens roughly estimates the number of model tokens of text.
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/4 + 1
+}
+
+// batches groups segs, in document order, into the batches sent to the
+// model. Without batching every segment is a batch of its own.
+func (j *job) batches(segs []*segment) [][]*segment {
+	budget := 0
+	bt, ok := j.service.llm.(BatchTranslator)
+	if ok && j.service.batchTokens != 0 {
+		budget = j.service.batchTokens
+		if budget < 0 {
+			budget = bt.BatchTokenBudget()
+		}
+	}
+
+	var batches [][]*segment
+	var batch []*segment
+	tokens := 0
+	for _, seg := range segs {
+		if seg.verbatim {
+			continue
+		}
+		_, core, _ := splitSpace(seg.source)
+		n := estimateTokens(core)
+		if len(batch) > 0 && (tokens+n > budget || len(batch) == maxBatchSegments) {
+			batches = append(batches, batch)
+			batch, tokens = nil, 0
+		}
+		batch = append(batch, seg)
+		tokens += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// translateBatch translates the segments of a batch with a single model
+// request. If the request fails or its response does not split back into
+// one translation per segment, the segments are translated one by one, as
+// are segments whose translation is rejected.
+func (j *job) translateBatch(ctx context.Context, batch []*segment) error {
+	if len(batch) == 1 {
+		return j.translateSegment(ctx, batch[0])
+	}
+	texts := make([]string, len(batch))
+	tokens := 0
+	for i, seg := range batch {
+		_, texts[i], _ = splitSpace(seg.source)
+		tokens += estimateTokens(texts[i])
+	}
+	ctx = withKeepLog(ctx, &keepLog{})
+	bctx := ctx
+	if terms := j.batchTerms(texts); terms != nil {
+		hints := prompt.HintsFromContext(ctx)
+		hints.Glossary = append(terms, hints.Glossary...)
+		bctx = prompt.WithHints(ctx, hints)
+	}
+	rc := &retryCounter{}
+	bctx = withRequestSize(withRetryCounter(bctx, rc), tokens)
+	translated, err := j.service.llm.(BatchTranslator).TranslateBatch(bctx, texts, j.sourceLang, j.targetLang)
+	j.retries.add(rc, batch...)
+	if err == nil && len(translated) != len(batch) {
+		err = fmt.Errorf("got %d translations for %d texts", len(translated), len(batch))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, seg := range batch {
+			if err := j.translateSegment(ctx, seg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, seg := range batch {
+		t, err := j.validate(texts[i], translated[i])
+		if err == nil {
+			err = j.applySegment(ctx, seg, t)
+		} else if errors.Is(err, ErrRejected) {
+			// Retry on its own, bypassing stored translations: models
+			// follow the instructions of a single request more closely.
+			err = j.retryRejected(ctx, seg)
+		} else {
+			err = j.fail(ctx, err, append([]*segment{seg}, seg.dups...)...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// MockBatchLLM is a MockLLM that also translates batches.
+type MockBatchLLM struct {
+	MockLLM
+	Budget    int
+	BatchFunc func(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error)
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (m *MockBatchLLM) TranslateBatch(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	m.mu.Lock()
+	m.batches = append(m.batches, texts)
+	m.mu.Unlock()
+	if m.BatchFunc != nil {
+		return m.BatchFunc(ctx, texts, sourceLang, targetLang)
+	}
+	out := make([]string, len(texts))
+	for i, text := range texts {
+		out[i] = "B:" + text
+	}
+	return out, nil
+}
+
+func (m *MockBatchLLM) BatchTokenBudget() int {
+	return m.Budget
+}
+
+func TestTranslate_Batching(t *testing.T) {
+	input := `<div><h1>Hello</h1><p>World</p><p>Line <b>bold</b> end</p><p title="Tip">Bye</p></div>`
+
+	tests := []struct {
+		name     string
+		budget   int
+		service  int
+		batches  int
+		expected string
+	}{
+		{
+			name:     "client budget",
+			budget:   100,
+			batches:  1,
+			expected: `<div><h1>B:Hello</h1><p>B:World</p><p>B:Line <b>bold</b> end</p><p title="B:Tip">B:Bye</p></div>`,
+		},
+		{
+			name:    "service budget",
+			budget:  100,
+			service: 4,
+			batches: 2,
+			// The inline segment exceeds the budget on its own and is sent
+			// as a single request.
+			expected: `<div><h1>B:Hello</h1><p>B:World</p><p>TR:Line <b>bold</b> end</p><p title="B:Tip">B:Bye</p></div>`,
+		},
+		{
+			name:     "client cannot batch",
+			budget:   0,
+			batches:  0,
+			expected: `<div><h1>TR:Hello</h1><p>TR:World</p><p>TR:Line <b>bold</b> end</p><p title="TR:Tip">TR:Bye</p></div>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLM := &MockBatchLLM{
+				MockLLM: MockLLM{
+					ModelName: "test-model",
+					TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+						return "TR:" + text, nil
+					},
+				},
+				Budget: tt.budget,
+			}
+			service := NewService(mockLLM, WithBatching(tt.service))
+
+			translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment("body"))
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if translated != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, translated)
+			}
+			if len(mockLLM.batches) != tt.batches {
+				t.Errorf("Expected %d batches, got %d: %q", tt.batches, len(mockLLM.batches), mockLLM.batches)
+			}
+		})
+	}
+}
+
+func TestTranslate_BatchingDisabled(t *testing.T) {
+	mockLLM := &MockBatchLLM{MockLLM: MockLLM{ModelName: "test-model"}, Budget: 100}
+	service := NewService(mockLLM)
+
+	if _, _, err := service.Translate(context.Background(), strings.NewReader(`<p>A</p><p>B</p>`), "en", "es"); err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if len(mockLLM.batches) != 0 {
+		t.Errorf("Expected no batches without WithBatching, got %q", mockLLM.batches)
+	}
+}
+
+func TestTranslate_BatchFallback(t *testing.T) {
+	tests := []struct {
+		name  string
+		batch func(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error)
+	}{
+		{
+			name: "error",
+			batch: func(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+				return nil, fmt.Errorf("malformed response")
+			},
+		},
+		{
+			name: "short response",
+			batch: func(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+				return []string{"B:" + texts[0]}, nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLM := &MockBatchLLM{
+				MockLLM: MockLLM{
+					ModelName: "test-model",
+					TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+						return "TR:" + text, nil
+					},
+				},
+				Budget:    100,
+				BatchFunc: tt.batch,
+			}
+			service := NewService(mockLLM, WithBatching(0))
+
+			translated, _, err := service.Translate(context.Background(), strings.NewReader(`<p>One</p><p>Two</p><p>Three</p>`), "en", "es", WithFragment("body"))
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			expected := `<p>TR:One</p><p>TR:Two</p><p>TR:Three</p>`
+			if translated != expected {
+				t.Errorf("Expected %s, got %s", expected, translated)
+			}
+		})
+	}
+}
+
+func TestTranslate_BatchPlaceholderFallback(t *testing.T) {
+	// A batch translation that loses the placeholders of one segment only
+	// falls back for that segment.
+	mockLLM := &MockBatchLLM{
+		MockLLM: MockLLM{
+			ModelName: "test-model",
+			TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+				return "TR:" + text, nil
+			},
+		},
+		Budget: 100,
+		BatchFunc: func(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+			return []string{"B:Intro", "B:Click here now"}, nil
+		},
+	}
+	service := NewService(mockLLM, WithBatching(0))
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(`<p>Intro</p><p>Click <a href="/">here</a> now</p>`), "en", "es", WithFragment("body"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<p>B:Intro</p><p>TR:Click <a href="/">TR:here</a> TR:now</p>`
+	if translated != expected {
+		t.Errorf("Expected %s, got %s", expected, translated)
+	}
+}
@@ -0,0 +1,43 @@
+package translator
+
+import "strings"
+
+// DedupeStats reports the segments of a document sharing their text with
+// an earlier segment. Such segments are not sent to the model: they take
+// the translation of the first segment with their text.
+type DedupeStats struct {
+	Segments int `json:"segments"`
+	// Unique is the number of distinct texts among the segments.
+	Unique int `json:"unique"`
+	// Ratio is the fraction of segments that took the translation of an
+	// earlier one.
+	Ratio float64 `json:"ratio"`
+}
+
+// dedupeKey returns the text segments are grouped by: the source with runs
+// of whitespace collapsed, so that occurrences differing only in layout
+// share a translation.
+func dedupeKey(seg *segment) string {
+	return strings.Join(strings.Fields(seg.source), " ")
+}
+
+// dedupe returns the first segment of segs with each text, in document
+// order, with the later segments with the same text as its dups.
+func dedupe(segs []*segment) ([]*segment, DedupeStats) {
+	first := make(map[string]*segment)
+	var unique []*segment
+	for _, seg := range segs {
+		key := dedupeKey(seg)
+		if f, ok := first[key]; ok {
+			f.dups = append(f.dups, seg)
+			continue
+		}
+		first[key] = seg
+		unique = append(unique, seg)
+	}
+	st := DedupeStats{Segments: len(segs), Unique: len(unique)}
+	if len(segs) > 0 {
+		st.Ratio = float64(len(segs)-len(unique)) / float64(len(segs))
+	}
+	return unique, st
+}
@@ -0,0 +1,64 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTranslate_Dedupe(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			mu.Lock()
+			calls[text]++
+			mu.Unlock()
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	input := `<ul><li>Mostly sunny</li><li> Mostly  sunny </li><li>Rain</li></ul><img alt="Mostly sunny"/>`
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment(""))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<ul><li>TR:Mostly sunny</li><li> TR:Mostly sunny </li><li>TR:Rain</li></ul><img alt="TR:Mostly sunny"/>`
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	if calls["Mostly sunny"] != 1 || calls["Rain"] != 1 || len(calls) != 2 {
+		t.Errorf("Expected one request per distinct text, got %v", calls)
+	}
+	want := DedupeStats{Segments: 4, Unique: 2, Ratio: 0.5}
+	if metadata.Dedupe != want {
+		t.Errorf("Expected dedupe stats %+v, got %+v", want, metadata.Dedupe)
+	}
+}
+
+func TestTranslate_DedupeFailure(t *testing.T) {
+	service := NewService(failingLLM("World"))
+
+	input := `<p>World</p><p>Hello</p><p>World</p>`
+	_, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es",
+		WithFragment(""), WithFailureMode(BestEffort))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	// Every occurrence of a failed text is reported.
+	want := []SegmentFailure{
+		{Segment: 0, Path: "/p[1]", Error: "model unavailable"},
+		{Segment: 2, Path: "/p[3]", Error: "model unavailable"},
+	}
+	if len(metadata.Failures) != len(want) {
+		t.Fatalf("Expected failures %+v, got %+v", want, metadata.Failures)
+	}
+	for i := range want {
+		if metadata.Failures[i] != want[i] {
+			t.Errorf("Expected failure %+v, got %+v", want[i], metadata.Failures[i])
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package translator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Format selects how the input is parsed and the output serialized.
+type Format string
+
+const (
+	// FormatAuto uses FormatXHTML for input that starts with an XML
+	// declaration or declares the XHTML namespace on its root element,
+	// falling back to FormatHTML if that input is not well-formed XML.
+	FormatAuto Format = "auto"
+	// FormatHTML parses and renders with the HTML5 algorithms.
+	FormatHTML Format = "html"
+	// FormatXHTML parses the input as XML and produces well-formed XHTML,
+	// preserving the XML declaration, doctype, namespace declarations and
+	// prefixed attributes such as xml:lang.
+	FormatXHTML Format = "xhtml"
+)
+
+// ParseFormat converts a format name into a Format. The empty string
+// selects FormatAuto.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatAuto, nil
+	case FormatAuto, FormatHTML, FormatXHTML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+// fragmentRoot is the name of the element wrapping an XHTML fragment
+// while it is parsed.
+const fragmentRoot = "_fragment"
+
+// document is a parsed input along with what is needed to serialize it
+// back in its original format.
+type document struct {
+	root   *html.Node
+	format Format
+	// fragment is set when root is a synthetic context element whose
+	// children are the parsed nodes; only the children are rendered.
+	fragment bool
+	// prolog and epilog hold the markup around the root element of an
+	// XHTML document, verbatim.
+	prolog string
+	epilog string
+	// raw is set for documents parsed for minimal-diff output; it maps
+	// nodes to the bytes they were parsed from.
+	raw map[*html.Node]*rawToken
+}
+
+// parseDocument parses input according to the format, fragment and
+// minimal-diff options.
+func parseDocument(input string, o options) (*document, error) {
+	if o.minimalDiff {
+		// Minimal-diff documents are rendered from their original bytes,
+		// so fragments need no special parsing.
+		doc, err := parsePatchable(input, o.format)
+		if err != nil {
+			return nil, err
+		}
+		doc.fragment = o.fragmentContext != ""
+		return doc, nil
+	}
+	return parseTree(input, o.format, o.fragmentContext)
+}
+
+// parseTree parses input according to format. A non-empty fragmentContext
+// parses input as a fragment in the context of an element of that name,
+// as html.ParseFragment does, instead of a full document.
+func parseTree(input string, format Format, fragmentContext string) (*document, error) {
+	if format == FormatAuto {
+		if looksLikeXHTML(input) {
+			if doc, err := parseTree(input, FormatXHTML, fragmentContext); err == nil {
+				return doc, nil
+			}
+		}
+		format = FormatHTML
+	}
+
+	if fragmentContext != "" {
+		return parseFragment(input, format, fragmentContext)
+	}
+
+	if format == FormatXHTML {
+		root, prolog, epilog, err := parseXHTML(input)
+		if err != nil {
+			return nil, err
+		}
+		return &document{root: root, format: format, prolog: prolog, epilog: epilog}, nil
+	}
+
+	root, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	return &document{root: root, format: FormatHTML}, nil
+}
+
+// parseFragment parses input as the content of a contextElement element.
+func parseFragment(input string, format Format, contextElement string) (*document, error) {
+	a := atom.Lookup([]byte(contextElement))
+	if a == 0 {
+		return nil, fmt.Errorf("unknown fragment context element %q", contextElement)
+	}
+
+	if format == FormatXHTML {
+		root, _, _, err := parseXHTML("<" + fragmentRoot + ">" + input + "</" + fragmentRoot + ">")
+		if err != nil {
+			return nil, err
+		}
+		parent := root.FirstChild
+		root.RemoveChild(parent)
+		parent.Data = contextElement
+		return &document{root: parent, format: format, fragment: true}, nil
+	}
+
+	parent := &html.Node{Type: html.ElementNode, Data: contextElement, DataAtom: a}
+	nodes, err := html.ParseFragment(strings.NewReader(input), parent)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		parent.AppendChild(n)
+	}
+	return &document{root: parent, format: FormatHTML, fragment: true}, nil
+}
+
+// render serializes the document.
+func (d *document) render(w io.Writer) error {
+	if d.raw != nil {
+		return d.renderPatched(w)
+	}
+	if d.fragment {
+		for c := d.root.FirstChild; c != nil; c = c.NextSibling {
+			if err := d.renderNode(w, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if d.format != FormatXHTML {
+		return html.Render(w, d.root)
+	}
+	if _, err := io.WriteString(w, d.prolog); err != nil {
+		return err
+	}
+	if err := renderXHTML(w, d.root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, d.epilog)
+	return err
+}
+
+// renderNode serializes n and its descendants in the document's format.
+func (d *document) renderNode(w io.Writer, n *html.Node) error {
+	if d.format == FormatXHTML {
+		return renderXHTML(w, n)
+	}
+	return html.Render(w, n)
+}
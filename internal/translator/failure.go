@@ -0,0 +1,170 @@
+package translator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// FailureMode controls what a Translate call does when a segment cannot be
+// translated.
+type FailureMode string
+
+const (
+	// FailFast cancels the model requests in flight and returns the first
+	// error.
+	FailFast FailureMode = "fail-fast"
+	// BestEffort leaves failed segments in the source language and reports
+	// them in Metadata.Failures.
+	BestEffort FailureMode = "best-effort"
+)
+
+// ParseFailureMode parses a failure mode name. The empty string means
+// FailFast.
+func ParseFailureMode(s string) (FailureMode, error) {
+	switch m := FailureMode(s); m {
+	case "":
+		return FailFast, nil
+	case FailFast, BestEffort:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown failure mode %q (want fail-fast or best-effort)", s)
+}
+
+// WithFailureMode sets what the call does when a segment cannot be
+// translated. The default is FailFast.
+func WithFailureMode(mode FailureMode) Option {
+	return func(o *options) {
+		o.failureMode = mode
+	}
+}
+
+// FailedAttribute marks, with WithFailureMarking, the elements whose
+// content or attributes could not be translated. Its value lists what
+// failed: "content" and the names of the attributes.
+const FailedAttribute = "data-translation-failed"
+
+// WithFailureMarking marks the elements of the segments listed in
+// Metadata.Failures with the FailedAttribute.
+func WithFailureMarking() Option {
+	return func(o *options) {
+		o.markFailures = true
+	}
+}
+
+// SegmentFailure reports a segment left in the source language in
+// BestEffort mode, or because its translation was rejected.
+type SegmentFailure struct {
+	// Segment is the index of the segment in document order.
+	Segment int `json:"segment"`
+	// Path locates the element holding the segment, as an XPath such as
+	// "/html[1]/body[1]/p[2]", followed by "/@name" for an attribute.
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// failure is a segment that failed, with its error.
+type failure struct {
+	seg *segment
+	err error
+}
+
+// failureLog collects the failed segments of a Translate call.
+type failureLog struct {
+	mu       sync.Mutex
+	failures []failure
+}
+
+// add records that seg failed with err.
+func (l *failureLog) add(seg *segment, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures = append(l.failures, failure{seg: seg, err: err})
+}
+
+// list returns the failures in document order, with paths relative to
+// root, or nil if there were none.
+func (l *failureLog) list(root *html.Node) []SegmentFailure {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var list []SegmentFailure
+	for _, f := range l.failures {
+		list = append(list, SegmentFailure{
+			Segment: f.seg.index,
+			Path:    segmentPath(root, f.seg),
+			Error:   f.err.Error(),
+		})
+	}
+	sort.SliceStable(list, func(a, b int) bool { return list[a].Segment < list[b].Segment })
+	return list
+}
+
+// mark sets the FailedAttribute on the elements of the failed segments
+// below root.
+func (l *failureLog) mark(root *html.Node) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, f := range l.failures {
+		n := f.seg.node
+		if n == nil || n == root || n.Type != html.ElementNode {
+			continue
+		}
+		what := f.seg.attr
+		if what == "" {
+			what = "content"
+		}
+		if v, ok := attr(n, FailedAttribute); ok {
+			if containsField(v, what) {
+				continue
+			}
+			what = v + " " + what
+		}
+		setAttr(n, "", FailedAttribute, what)
+	}
+}
+
+func containsField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentPath returns the path of seg's element below root.
+func segmentPath(root *html.Node, seg *segment) string {
+	path := nodePath(root, seg.node)
+	if seg.attr != "" {
+		path += "/@" + seg.attr
+	}
+	if path == "" {
+		path = "/"
+	}
+	return path
+}
+
+// nodePath returns the XPath of element n below root, with the position of
+// every element among its siblings of the same name.
+func nodePath(root, n *html.Node) string {
+	var steps []string
+	for ; n != nil && n != root && n.Type == html.ElementNode; n = n.Parent {
+		pos := 1
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == html.ElementNode && s.Data == n.Data {
+				pos++
+			}
+		}
+		steps = append(steps, n.Data+"["+strconv.Itoa(pos)+"]")
+	}
+	var b strings.Builder
+	for i := len(steps) - 1; i >= 0; i-- {
+		b.WriteString("/")
+		b.WriteString(steps[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingLLM fails the texts in fail and translates the others.
+func failingLLM(fail ...string) *MockLLM {
+	return &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			for _, f := range fail {
+				if text == f {
+					return "", errors.New("model unavailable")
+				}
+			}
+			return "TR:" + text, nil
+		},
+	}
+}
+
+func TestTranslate_BestEffort(t *testing.T) {
+	service := NewService(failingLLM("World", "A picture"))
+
+	input := `<h1>Hello</h1><p>World</p><img alt="A picture" title="Title"/>`
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es",
+		WithFragment(""), WithFailureMode(BestEffort), WithFailureMarking())
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<h1>TR:Hello</h1><p data-translation-failed="content">World</p><img alt="A picture" title="TR:Title" data-translation-failed="alt"/>`
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+
+	want := []SegmentFailure{
+		{Segment: 1, Path: "/p[1]", Error: "model unavailable"},
+		{Segment: 2, Path: "/img[1]/@alt", Error: "model unavailable"},
+	}
+	if len(metadata.Failures) != len(want) {
+		t.Fatalf("Expected failures %+v, got %+v", want, metadata.Failures)
+	}
+	for i := range want {
+		if metadata.Failures[i] != want[i] {
+			t.Errorf("Expected failure %+v, got %+v", want[i], metadata.Failures[i])
+		}
+	}
+}
+
+func TestTranslate_BestEffortUnmarked(t *testing.T) {
+	service := NewService(failingLLM("World"))
+
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(`<div><p>Hello</p><p>World</p></div>`), "en", "es", WithFailureMode(BestEffort))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if !strings.Contains(translated, "<p>TR:Hello</p><p>World</p>") {
+		t.Errorf("Expected the failed segment left untranslated and unmarked, got %q", translated)
+	}
+	if len(metadata.Failures) != 1 || metadata.Failures[0].Path != "/html[1]/body[1]/div[1]/p[2]" {
+		t.Errorf("Expected one failure at the second paragraph, got %+v", metadata.Failures)
+	}
+}
+
+func TestTranslate_FailFastCancels(t *testing.T) {
+	var cancelled atomic.Int64
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			if text == "Fail" {
+				return "", errors.New("model unavailable")
+			}
+			select {
+			case <-ctx.Done():
+				cancelled.Add(1)
+				return "", ctx.Err()
+			case <-time.After(5 * time.Second):
+				return text, nil
+			}
+		},
+	}
+	service := NewService(mockLLM)
+
+	input := `<p>One</p><p>Two</p><p>Fail</p><p>Three</p><p>Four</p><p>Five</p>`
+	start := time.Now()
+	_, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
+	if err == nil || err.Error() != "model unavailable" {
+		t.Errorf("Expected the model error, got %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Expected in-flight requests to be cancelled, took %v", d)
+	}
+	if cancelled.Load() == 0 {
+		t.Error("Expected in-flight requests to see the cancellation")
+	}
+}
+
+func TestParseFailureMode(t *testing.T) {
+	for s, want := range map[string]FailureMode{"": FailFast, "fail-fast": FailFast, "best-effort": BestEffort} {
+		if got, err := ParseFailureMode(s); err != nil || got != want {
+			t.Errorf("ParseFailureMode(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseFailureMode("ignore"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
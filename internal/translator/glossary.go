@@ -0,0 +1,134 @@
+package translator
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+	"golang.org/x/net/html"
+)
+
+// Glossary supplies the mandated translations of terms.
+type Glossary interface {
+	// Match returns the terms occurring in text with their mandated
+	// translation from sourceLang into targetLang. A term whose target is
+	// its source must not be translated.
+	Match(text, sourceLang, targetLang string) []prompt.Term
+}
+
+// WithGlossary gives the model the mandated translations of the terms each
+// segment contains, and checks that its translation contains them. A
+// segment whose translation misses a term is translated once more,
+// bypassing stored translations; if the term is still missing, the
+// translation is kept and reported in Metadata.GlossaryViolations.
+func WithGlossary(g Glossary) ServiceOption {
+	return func(s *Service) {
+		s.glossary = g
+	}
+}
+
+// GlossaryViolation reports a segment whose translation does not contain
+// the mandated translation of a term of its source.
+type GlossaryViolation struct {
+	// Segment is the index of the segment in document order.
+	Segment int `json:"segment"`
+	// Path locates the element holding the segment, as in SegmentFailure.
+	Path   string `json:"path"`
+	Term   string `json:"term"`
+	Target string `json:"target"`
+}
+
+// terms returns the glossary terms occurring in text.
+func (j *job) terms(text string) []prompt.Term {
+	if j.service.glossary == nil {
+		return nil
+	}
+	return j.service.glossary.Match(text, j.sourceLang, j.targetLang)
+}
+
+// batchTerms returns the glossary terms occurring in any of texts.
+func (j *job) batchTerms(texts []string) []prompt.Term {
+	var terms []prompt.Term
+	seen := make(map[prompt.Term]bool)
+	for _, text := range texts {
+		for _, t := range j.terms(text) {
+			if !seen[t] {
+				seen[t] = true
+				terms = append(terms, t)
+			}
+		}
+	}
+	return terms
+}
+
+// missingTerms returns the glossary terms of seg whose target does not
+// occur, in any case, in its translation.
+func (j *job) missingTerms(seg *segment, translated string) []prompt.Term {
+	_, core, _ := splitSpace(seg.source)
+	var missing []prompt.Term
+	lower := strings.ToLower(translated)
+	for _, t := range j.terms(core) {
+		if !strings.Contains(lower, strings.ToLower(t.Target)) {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// termsMissed handles a translation of seg that misses glossary terms: the
+// segment is translated once more, bypassing stored translations, and it
+// reports true. If that translation misses terms too, they are recorded
+// against seg and its duplicates, and it reports false: the translation is
+// kept.
+func (j *job) termsMissed(ctx context.Context, seg *segment, missing []prompt.Term) (bool, error) {
+	if !seg.termRetry {
+		retry := *seg
+		retry.termRetry = true
+		return true, j.translateSegment(withMemoryRefresh(ctx), &retry)
+	}
+	j.violations.add(missing, append([]*segment{seg}, seg.dups...)...)
+	return false, nil
+}
+
+// violation is a glossary term missing from the translation of a segment.
+type violation struct {
+	seg  *segment
+	term prompt.Term
+}
+
+// violationLog collects the glossary violations of a Translate call.
+type violationLog struct {
+	mu         sync.Mutex
+	violations []violation
+}
+
+// add records that the translations of segs miss terms.
+func (l *violationLog) add(terms []prompt.Term, segs ...*segment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, seg := range segs {
+		for _, t := range terms {
+			l.violations = append(l.violations, violation{seg: seg, term: t})
+		}
+	}
+}
+
+// list returns the violations in document order, with paths relative to
+// root, or nil if there were none.
+func (l *violationLog) list(root *html.Node) []GlossaryViolation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var list []GlossaryViolation
+	for _, v := range l.violations {
+		list = append(list, GlossaryViolation{
+			Segment: v.seg.index,
+			Path:    segmentPath(root, v.seg),
+			Term:    v.term.Source,
+			Target:  v.term.Target,
+		})
+	}
+	sort.SliceStable(list, func(a, b int) bool { return list[a].Segment < list[b].Segment })
+	return list
+}
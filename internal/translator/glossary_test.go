@@ -0,0 +1,76 @@
+package translator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
+)
+
+// mapGlossary maps terms to their mandated translations.
+type mapGlossary map[string]string
+
+func (g mapGlossary) Match(text, sourceLang, targetLang string) []prompt.Term {
+	var terms []prompt.Term
+	for source, target := range g {
+		if strings.Contains(text, source) {
+			terms = append(terms, prompt.Term{Source: source, Target: target})
+		}
+	}
+	return terms
+}
+
+func TestTranslate_Glossary(t *testing.T) {
+	var calls, refreshes atomic.Int64
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			calls.Add(1)
+			if MemoryPolicyFromContext(ctx) == MemoryRefresh {
+				refreshes.Add(1)
+			}
+			glossary := prompt.HintsFromContext(ctx).Glossary
+			switch text {
+			case "Heat index of 105":
+				if !reflect.DeepEqual(glossary, []prompt.Term{{Source: "Heat index", Target: "Índice de calor"}}) {
+					t.Errorf("Expected the term in the prompt, got %v", glossary)
+				}
+				return "índice de calor de 105", nil
+			case "Heat index tonight":
+				// Ignores the glossary.
+				return "Sensación térmica esta noche", nil
+			}
+			if glossary != nil {
+				t.Errorf("Expected no terms for %q, got %v", text, glossary)
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM, WithGlossary(mapGlossary{"Heat index": "Índice de calor"}))
+
+	input := `<p>Heat index of 105</p><p>Heat index tonight</p><p>Clear</p><p>Heat index tonight</p>`
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment(""))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	// The translation missing the term is kept.
+	expected := `<p>índice de calor de 105</p><p>Sensación térmica esta noche</p><p>TR:Clear</p><p>Sensación térmica esta noche</p>`
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	want := []GlossaryViolation{
+		{Segment: 1, Path: "/p[2]", Term: "Heat index", Target: "Índice de calor"},
+		{Segment: 3, Path: "/p[4]", Term: "Heat index", Target: "Índice de calor"},
+	}
+	if !reflect.DeepEqual(metadata.GlossaryViolations, want) {
+		t.Errorf("Expected violations %+v, got %+v", want, metadata.GlossaryViolations)
+	}
+	// The segment missing the term is translated once more, bypassing
+	// stored translations.
+	if n, r := calls.Load(), refreshes.Load(); n != 4 || r != 1 {
+		t.Errorf("Expected 4 model calls with 1 refresh, got %d with %d", n, r)
+	}
+}
@@ -0,0 +1,147 @@
+package translator
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
+)
+
+// sameLanguage reports whether two language tags share their primary
+// language subtag, e.g. "en" and "en-US".
+func sameLanguage(a, b string) bool {
+	return lang.Primary(a) != "" && lang.Primary(a) == lang.Primary(b)
+}
+
+// isLangAttr reports whether a is a lang or xml:lang attribute, as parsed
+// by any of the document parsers.
+func isLangAttr(a html.Attribute) bool {
+	return a.Namespace == "" && (a.Key == "lang" || a.Key == "xml:lang") ||
+		a.Namespace == "xml" && a.Key == "lang"
+}
+
+// setAttr sets attribute key of n, appending it if n does not have it.
+func setAttr(n *html.Node, namespace, key, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == namespace && a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Namespace: namespace, Key: key, Val: val})
+}
+
+// localize updates the language metadata of a translated document: lang
+// and xml:lang on the root element and on every element that declared the
+// source language are set to the target language, and the root's dir
+// follows the target's writing direction. For right-to-left targets,
+// content left untranslated is marked dir="ltr", which isolates it from
+// the surrounding text.
+func localize(doc *document, sourceLang, targetLang string, skip []Selector) {
+	if sameLanguage(sourceLang, targetLang) {
+		return
+	}
+	rtl := lang.IsRTL(targetLang)
+	isolate := rtl && !lang.IsRTL(sourceLang)
+
+	var walk func(n *html.Node, translate bool)
+	walk = func(n *html.Node, translate bool) {
+		if n.Type == html.ElementNode {
+			parentTranslated := translate
+			translate = translatable(n, translate, skip)
+			if translate {
+				for i, a := range n.Attr {
+					if isLangAttr(a) && sameLanguage(a.Val, sourceLang) {
+						n.Attr[i].Val = targetLang
+						if _, ok := attr(n, "dir"); ok || doc.fragment && n.Parent == doc.root {
+							setAttr(n, "", "dir", direction(rtl))
+						}
+					}
+				}
+			} else if isolate && parentTranslated && !rawTextElements[n.Data] {
+				if _, ok := attr(n, "dir"); !ok {
+					setAttr(n, "", "dir", "ltr")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, translate)
+		}
+	}
+	for c := doc.root.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, true)
+	}
+
+	if root := doc.rootElement(); root != nil {
+		setAttr(root, "", "lang", targetLang)
+		xmlLang := doc.format == FormatXHTML
+		for _, a := range root.Attr {
+			if a.Key == "xml:lang" {
+				// Parsed as HTML, the attribute keeps its prefix in the key.
+				setAttr(root, "", "xml:lang", targetLang)
+				xmlLang = false
+			}
+		}
+		if xmlLang {
+			setAttr(root, "xml", "lang", targetLang)
+		}
+		if dir, ok := attr(root, "dir"); rtl || ok && dir != "auto" {
+			setAttr(root, "", "dir", direction(rtl))
+		}
+	}
+}
+
+// direction returns the value of the dir attribute for a writing direction.
+func direction(rtl bool) string {
+	if rtl {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// rootElement returns the html element of a full document, or nil for
+// fragments and documents without one.
+func (d *document) rootElement() *html.Node {
+	if d.fragment {
+		return nil
+	}
+	for c := d.root.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			if c.Data == "html" {
+				return c
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// ltrRunPattern matches runs of left-to-right text, such as numbers, units
+// and untranslated names, within a translation.
+var ltrRunPattern = regexp.MustCompile(`[\p{Latin}\p{Nd}](?:[\p{Latin}\p{Nd} .,:/%+'’-]*[\p{Latin}\p{Nd}%])?`)
+
+const (
+	leftToRightIsolate    = "\u2066"
+	popDirectionalIsolate = "\u2069"
+)
+
+// isolateLTR wraps the left-to-right runs of a right-to-left translation in
+// Unicode bidi isolates, so that numbers and Latin-script names keep their
+// order and do not reorder the text around them. Inline placeholders are
+// left untouched.
+func isolateLTR(text string) string {
+	if strings.Contains(text, leftToRightIsolate) {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(ltrRunPattern.ReplaceAllString(text[last:m[0]], leftToRightIsolate+"$0"+popDirectionalIsolate))
+		b.WriteString(text[m[0]:m[1]])
+		last = m[1]
+	}
+	b.WriteString(ltrRunPattern.ReplaceAllString(text[last:], leftToRightIsolate+"$0"+popDirectionalIsolate))
+	return b.String()
+}
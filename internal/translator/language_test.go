@@ -0,0 +1,127 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
+)
+
+func TestTranslate_Language(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			if lang.IsRTL(targetLang) {
+				return "ترجمة", nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	tests := []struct {
+		name       string
+		input      string
+		sourceLang string
+		targetLang string
+		opts       []Option
+		expected   string
+	}{
+		{
+			name:       "root lang",
+			input:      `<html><body><p>Hi</p></body></html>`,
+			sourceLang: "en",
+			targetLang: "fr",
+			expected:   `<html lang="fr"><head></head><body><p>TR:Hi</p></body></html>`,
+		},
+		{
+			name:       "rtl target",
+			input:      `<html lang="en" dir="ltr"><body><p>Hi</p></body></html>`,
+			sourceLang: "en",
+			targetLang: "ar",
+			expected:   `<html lang="ar" dir="rtl"><head></head><body><p>ترجمة</p></body></html>`,
+		},
+		{
+			name:       "rtl back to ltr",
+			input:      `<html lang="he" dir="rtl"><body><p>Hi</p></body></html>`,
+			sourceLang: "he",
+			targetLang: "en",
+			expected:   `<html lang="en" dir="ltr"><head></head><body><p>TR:Hi</p></body></html>`,
+		},
+		{
+			name:       "nested lang",
+			input:      `<html lang="en"><body><p lang="en-US">Hi</p><p lang="de">Hallo</p><p lang="en" translate="no">Acme</p></body></html>`,
+			sourceLang: "en",
+			targetLang: "es",
+			expected:   `<html lang="es"><head></head><body><p lang="es">TR:Hi</p><p lang="de">TR:Hallo</p><p lang="en" translate="no">Acme</p></body></html>`,
+		},
+		{
+			name:       "untranslated content isolated in rtl",
+			input:      `<html><body><p>Run <code>go test</code> now</p><pre>x := 1</pre></body></html>`,
+			sourceLang: "en",
+			targetLang: "fa",
+			expected:   `<html lang="fa" dir="rtl"><head></head><body><p>ترجمة <code dir="ltr">go test</code> ترجمة</p><pre dir="ltr">x := 1</pre></body></html>`,
+		},
+		{
+			name:       "same language",
+			input:      `<html lang="en-GB"><body><p>Hi</p></body></html>`,
+			sourceLang: "en",
+			targetLang: "en-US",
+			expected:   `<html lang="en-GB"><head></head><body><p>TR:Hi</p></body></html>`,
+		},
+		{
+			name:       "fragment",
+			input:      `<p lang="en">Hi</p><p>There</p>`,
+			sourceLang: "en",
+			targetLang: "ar",
+			opts:       []Option{WithFragment("body")},
+			expected:   `<p lang="ar" dir="rtl">ترجمة</p><p>ترجمة</p>`,
+		},
+		{
+			name:       "minimal diff",
+			input:      "<html lang='en'>\n<body><p>Hi</p></body></html>",
+			sourceLang: "en",
+			targetLang: "ur",
+			opts:       []Option{WithMinimalDiff()},
+			expected:   "<html lang='ur' dir=\"rtl\">\n<body><p>ترجمة</p></body></html>",
+		},
+		{
+			name:       "xhtml",
+			input:      `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Hi</p></body></html>`,
+			sourceLang: "en",
+			targetLang: "es",
+			expected:   `<html xmlns="http://www.w3.org/1999/xhtml" lang="es" xml:lang="es"><body><p>TR:Hi</p></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			translated, _, err := service.Translate(context.Background(), strings.NewReader(tt.input), tt.sourceLang, tt.targetLang, tt.opts...)
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if translated != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, translated)
+			}
+		})
+	}
+}
+
+func TestTranslate_IsolateLTR(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return "عاصفة <g1>Acme Cloud</g1> بسرعة 40 mph", nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(`<p>Storm at <b>Acme Cloud</b> with 40 mph</p>`), "en", "ar", WithFragment("body"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := "<p>عاصفة <b>⁦Acme Cloud⁩</b> بسرعة ⁦40 mph⁩</p>"
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+}
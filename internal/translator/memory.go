@@ -0,0 +1,158 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryPolicy controls how a Translate call uses the translation memory
+// wrapped around the LLMClient, if there is one.
+type MemoryPolicy string
+
+const (
+	// MemoryUse serves stored translations and stores new ones.
+	MemoryUse MemoryPolicy = "use"
+	// MemoryBypass neither reads nor writes the memory.
+	MemoryBypass MemoryPolicy = "bypass"
+	// MemoryRefresh ignores stored translations and overwrites them with
+	// fresh ones from the model.
+	MemoryRefresh MemoryPolicy = "refresh"
+)
+
+// ParseMemoryPolicy parses a memory policy name. The empty string means
+// MemoryUse.
+func ParseMemoryPolicy(s string) (MemoryPolicy, error) {
+	switch p := MemoryPolicy(s); p {
+	case "":
+		return MemoryUse, nil
+	case MemoryUse, MemoryBypass, MemoryRefresh:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown memory policy %q (want use, bypass or refresh)", s)
+}
+
+// WithMemoryPolicy sets how the call uses the translation memory. The
+// default is MemoryUse.
+func WithMemoryPolicy(policy MemoryPolicy) Option {
+	return func(o *options) {
+		o.memory = policy
+	}
+}
+
+// MemoryStats counts the translation memory lookups of a Translate call.
+type MemoryStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// memoryContext carries the memory policy of a Translate call and counts
+// its lookups.
+type memoryContext struct {
+	policy       MemoryPolicy
+	hits, misses atomic.Int64
+}
+
+type memoryContextKey struct{}
+
+// withMemoryContext returns a context carrying mc.
+func withMemoryContext(ctx context.Context, mc *memoryContext) context.Context {
+	return context.WithValue(ctx, memoryContextKey{}, mc)
+}
+
+// MemoryPolicyFromContext returns the memory policy of the Translate call
+// ctx belongs to, or MemoryUse outside of one.
+func MemoryPolicyFromContext(ctx context.Context) MemoryPolicy {
+	policy := MemoryUse
+	if mc, ok := ctx.Value(memoryContextKey{}).(*memoryContext); ok && mc.policy != "" {
+		policy = mc.policy
+	}
+	if policy == MemoryUse && ctx.Value(memoryRefreshKey{}) != nil {
+		return MemoryRefresh
+	}
+	return policy
+}
+
+type memoryRefreshKey struct{}
+
+// withMemoryRefresh returns ctx asking for a fresh translation, rather
+// than a stored one, unless the call bypasses the memory: a request is
+// retried because its translation was unusable, and the memory may hold
+// that translation.
+func withMemoryRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, memoryRefreshKey{}, true)
+}
+
+// RecordMemoryLookup counts a translation memory hit or miss against the
+// Translate call ctx belongs to. Translation memories wrapping an
+// LLMClient call it for every lookup, so that Metadata can report them.
+func RecordMemoryLookup(ctx context.Context, hit bool) {
+	mc, ok := ctx.Value(memoryContextKey{}).(*memoryContext)
+	if !ok {
+		return
+	}
+	if hit {
+		mc.hits.Add(1)
+	} else {
+		mc.misses.Add(1)
+	}
+}
+
+// stats returns the lookups counted so far, or nil if there were none.
+func (mc *memoryContext) stats() *MemoryStats {
+	hits, misses := mc.hits.Load(), mc.misses.Load()
+	if hits == 0 && misses == 0 {
+		return nil
+	}
+	return &MemoryStats{Hits: int(hits), Misses: int(misses)}
+}
+
+// keepLog holds the translations the LLMClient keeps for later requests
+// once the translator accepts them, by source text.
+type keepLog struct {
+	mu    sync.Mutex
+	keeps map[string][]func()
+}
+
+type keepLogKey struct{}
+
+// withKeepLog returns ctx collecting the keeps of a model request in kl.
+func withKeepLog(ctx context.Context, kl *keepLog) context.Context {
+	return context.WithValue(ctx, keepLogKey{}, kl)
+}
+
+// KeepOnAccept defers keeping the translation of text for later requests,
+// e.g. in a translation memory or cache, until the translator has
+// validated and applied it, so that output it rejects is not served again.
+// LLM clients keeping translations call it instead of keeping them right
+// away. Outside of a Translate call, keep runs right away.
+func KeepOnAccept(ctx context.Context, text string, keep func()) {
+	kl, ok := ctx.Value(keepLogKey{}).(*keepLog)
+	if !ok {
+		keep()
+		return
+	}
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.keeps == nil {
+		kl.keeps = make(map[string][]func())
+	}
+	kl.keeps[text] = append(kl.keeps[text], keep)
+}
+
+// accept runs the keeps of the translation of text by the model request
+// ctx was passed to.
+func accept(ctx context.Context, text string) {
+	kl, ok := ctx.Value(keepLogKey{}).(*keepLog)
+	if !ok {
+		return
+	}
+	kl.mu.Lock()
+	keeps := kl.keeps[text]
+	delete(kl.keeps, text)
+	kl.mu.Unlock()
+	for _, keep := range keeps {
+		keep()
+	}
+}
@@ -0,0 +1,335 @@
+package translator
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// rawToken records the original bytes a node was parsed from, so that
+// unchanged parts of a document can be written back untouched.
+type rawToken struct {
+	// text is the raw token: the start tag of an element, or the whole
+	// token for text, comments and doctypes.
+	text string
+	// end is the raw end tag of an element, empty if it was implied.
+	end string
+	// data and attr are the node's original decoded content, used to
+	// detect whether the node was changed by a translation.
+	data string
+	attr []html.Attribute
+}
+
+// impliedEndTags lists, for a start tag, the open elements it closes
+// implicitly, so that the tree matches the document's structure closely
+// enough for segmentation.
+var impliedEndTags = map[string][]string{
+	"li":       {"li"},
+	"dt":       {"dt", "dd"},
+	"dd":       {"dt", "dd"},
+	"option":   {"option"},
+	"optgroup": {"option", "optgroup"},
+	"tr":       {"tr", "td", "th"},
+	"td":       {"td", "th"},
+	"th":       {"td", "th"},
+	"thead":    {"tbody", "tfoot", "tr", "td", "th"},
+	"tbody":    {"thead", "tbody", "tfoot", "tr", "td", "th"},
+	"tfoot":    {"thead", "tbody", "tr", "td", "th"},
+}
+
+// paragraphClosers are the start tags that implicitly close an open <p>.
+var paragraphClosers = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true,
+	"div": true, "dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "header": true, "hr": true, "main": true, "menu": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"ul": true,
+}
+
+// closesImplicitly reports whether a start tag named start ends the open
+// element named open.
+func closesImplicitly(open, start string) bool {
+	if open == "p" {
+		return paragraphClosers[start]
+	}
+	for _, name := range impliedEndTags[start] {
+		if name == open {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePatchable tokenizes input into a tree of html.Nodes, recording the
+// raw bytes of every token. Unlike html.Parse it does not run the HTML5
+// tree construction algorithm: no elements are added, so every byte of
+// the input belongs to exactly one node.
+func parsePatchable(input string, format Format) (*document, error) {
+	if format == FormatAuto {
+		format = FormatHTML
+		if looksLikeXHTML(input) {
+			format = FormatXHTML
+		}
+	}
+	doc := &document{
+		root:   &html.Node{Type: html.DocumentNode},
+		format: format,
+		raw:    make(map[*html.Node]*rawToken),
+	}
+
+	z := html.NewTokenizer(strings.NewReader(input))
+	stack := []*html.Node{doc.root}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return nil, z.Err()
+		}
+		raw := string(z.Raw())
+		tok := z.Token()
+		top := stack[len(stack)-1]
+
+		switch tt {
+		case html.TextToken, html.CommentToken, html.DoctypeToken:
+			n := &html.Node{Type: html.TextNode, Data: tok.Data}
+			switch tt {
+			case html.CommentToken:
+				n.Type = html.CommentNode
+			case html.DoctypeToken:
+				n.Type = html.DoctypeNode
+			}
+			top.AppendChild(n)
+			doc.raw[n] = &rawToken{text: raw, data: tok.Data}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for len(stack) > 1 && closesImplicitly(stack[len(stack)-1].Data, tok.Data) {
+				stack = stack[:len(stack)-1]
+			}
+			n := &html.Node{Type: html.ElementNode, Data: tok.Data, DataAtom: tok.DataAtom, Attr: tok.Attr}
+			stack[len(stack)-1].AppendChild(n)
+			doc.raw[n] = &rawToken{text: raw, attr: append([]html.Attribute(nil), tok.Attr...)}
+			if tt == html.StartTagToken && !voidElements[tok.Data] {
+				stack = append(stack, n)
+			}
+		case html.EndTagToken:
+			i := len(stack) - 1
+			for i > 0 && stack[i].Data != tok.Data {
+				i--
+			}
+			if i == 0 {
+				// A stray end tag is kept verbatim.
+				n := &html.Node{Type: html.RawNode, Data: raw}
+				top.AppendChild(n)
+				continue
+			}
+			doc.raw[stack[i]].end = raw
+			stack = stack[:i]
+		}
+	}
+	return doc, nil
+}
+
+// renderPatched writes the document back, reusing the original bytes of
+// every node the translation did not change.
+func (d *document) renderPatched(w io.Writer) error {
+	var b strings.Builder
+	for c := d.root.FirstChild; c != nil; c = c.NextSibling {
+		d.writePatched(&b, c)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (d *document) writePatched(b *strings.Builder, n *html.Node) {
+	r := d.raw[n]
+	switch n.Type {
+	case html.ElementNode:
+		if r == nil {
+			html.Render(b, n)
+			return
+		}
+		b.WriteString(patchStartTag(r.text, r.attr, n.Attr))
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			d.writePatched(b, c)
+		}
+		b.WriteString(r.end)
+	case html.TextNode:
+		if r != nil && r.data == n.Data {
+			b.WriteString(r.text)
+			return
+		}
+		b.WriteString(escapeXMLText(n.Data))
+	case html.RawNode:
+		b.WriteString(n.Data)
+	default:
+		if r != nil {
+			b.WriteString(r.text)
+			return
+		}
+		html.Render(b, n)
+	}
+}
+
+// rawAttr locates an attribute within a raw start tag.
+type rawAttr struct {
+	// end is the offset just past the attribute.
+	end int
+	// valStart and valEnd delimit the value, excluding quotes; both are
+	// -1 for an attribute without a value.
+	valStart, valEnd int
+	quote            byte
+}
+
+// scanStartTag returns the attributes of a raw start tag, in order, and
+// the offset just past the tag name.
+func scanStartTag(tag string) (attrs []rawAttr, nameEnd int) {
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+	i := 1
+	for i < len(tag) && !isSpace(tag[i]) && tag[i] != '/' && tag[i] != '>' {
+		i++
+	}
+	nameEnd = i
+	for {
+		for i < len(tag) && (isSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+		if i >= len(tag) || tag[i] == '>' {
+			return attrs, nameEnd
+		}
+		// Attribute name; a leading '=' is part of the name, as in the tokenizer.
+		i++
+		for i < len(tag) && !isSpace(tag[i]) && tag[i] != '/' && tag[i] != '>' && tag[i] != '=' {
+			i++
+		}
+		a := rawAttr{end: i, valStart: -1, valEnd: -1}
+		j := i
+		for j < len(tag) && isSpace(tag[j]) {
+			j++
+		}
+		if j < len(tag) && tag[j] == '=' {
+			j++
+			for j < len(tag) && isSpace(tag[j]) {
+				j++
+			}
+			if j < len(tag) && (tag[j] == '"' || tag[j] == '\'') {
+				a.quote = tag[j]
+				a.valStart = j + 1
+				k := strings.IndexByte(tag[a.valStart:], a.quote)
+				if k < 0 {
+					k = len(tag) - a.valStart
+				}
+				a.valEnd = a.valStart + k
+				i = min(a.valEnd+1, len(tag))
+			} else {
+				a.valStart = j
+				for j < len(tag) && !isSpace(tag[j]) && tag[j] != '>' {
+					j++
+				}
+				a.valEnd = j
+				i = j
+			}
+			a.end = i
+		}
+		attrs = append(attrs, a)
+	}
+}
+
+// patchStartTag rewrites the raw start tag of an element whose attributes
+// changed from old to attrs, touching only the changed values. Attributes
+// added after the original ones are inserted after the last attribute.
+func patchStartTag(tag string, old, attrs []html.Attribute) string {
+	if attributesEqual(old, attrs) {
+		return tag
+	}
+	raw, nameEnd := scanStartTag(tag)
+	if len(raw) != len(old) || len(attrs) < len(old) {
+		return renderStartTag(tag, attrs)
+	}
+	for i := range old {
+		if attrs[i].Key != old[i].Key || attrs[i].Namespace != old[i].Namespace {
+			return renderStartTag(tag, attrs)
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, a := range raw {
+		if attrs[i].Val == old[i].Val {
+			continue
+		}
+		if a.valStart < 0 || a.quote == 0 {
+			// Unquoted or missing values are replaced with a quoted one.
+			start := a.end
+			if a.valStart >= 0 {
+				start = strings.LastIndexByte(tag[:a.valStart], '=')
+			}
+			b.WriteString(tag[last:start])
+			b.WriteString(`="` + escapeAttrValue(attrs[i].Val, '"') + `"`)
+			last = a.end
+			continue
+		}
+		b.WriteString(tag[last:a.valStart])
+		b.WriteString(escapeAttrValue(attrs[i].Val, a.quote))
+		last = a.valEnd
+	}
+	insert := nameEnd
+	if len(raw) > 0 {
+		insert = raw[len(raw)-1].end
+	}
+	b.WriteString(tag[last:insert])
+	for _, a := range attrs[len(old):] {
+		b.WriteString(" " + attributeName(a) + `="` + escapeAttrValue(a.Val, '"') + `"`)
+	}
+	b.WriteString(tag[insert:])
+	return b.String()
+}
+
+// renderStartTag writes a new start tag for the element whose raw start
+// tag is tag, preserving its name and whether it was self-closing.
+func renderStartTag(tag string, attrs []html.Attribute) string {
+	_, nameEnd := scanStartTag(tag)
+	var b strings.Builder
+	b.WriteString(tag[:nameEnd])
+	for _, a := range attrs {
+		b.WriteString(" " + attributeName(a) + `="` + escapeAttrValue(a.Val, '"') + `"`)
+	}
+	if strings.HasSuffix(tag, "/>") {
+		b.WriteString(" />")
+	} else {
+		b.WriteString(">")
+	}
+	return b.String()
+}
+
+// attributeName returns the name an attribute is written with.
+func attributeName(a html.Attribute) string {
+	if a.Namespace == "" {
+		return a.Key
+	}
+	return a.Namespace + ":" + a.Key
+}
+
+// attributesEqual reports whether a and b hold the same attributes.
+func attributesEqual(a, b []html.Attribute) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeAttrValue escapes s for an attribute value delimited by quote.
+func escapeAttrValue(s string, quote byte) string {
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;").Replace(s)
+	if quote == '\'' {
+		return strings.ReplaceAll(s, "'", "&#39;")
+	}
+	return strings.ReplaceAll(s, `"`, "&quot;")
+}
@@ -0,0 +1,114 @@
+package translator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestTranslate_MinimalDiff(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	input := "<!DOCTYPE html>\n<HTML Lang=en>\n<Body>\n" +
+		"  <P CLASS=intro>Hello   &quot;world&quot;</P>\n" +
+		"  <img src='sun.png' alt='Sunny &amp; warm' >\n" +
+		"  <input type=submit value=Go>\n" +
+		"  <ul><li>One<li>Two</ul>\n" +
+		"  <p>Caf&eacute; <b>open</b><br>late</p>\n" +
+		"  <script>if (a<b) {}</script>\n" +
+		"</Body>\n</HTML>\n"
+	expected := "<!DOCTYPE html>\n<HTML Lang=\"es\">\n<Body>\n" +
+		"  <P CLASS=intro>TR:Hello   \"world\"</P>\n" +
+		"  <img src='sun.png' alt='TR:Sunny &amp; warm' >\n" +
+		"  <input type=submit value=\"TR:Go\">\n" +
+		"  <ul><li>TR:One<li>TR:Two</ul>\n" +
+		"  <p>TR:Café <b>open</b><br>late</p>\n" +
+		"  <script>if (a<b) {}</script>\n" +
+		"</Body>\n</HTML>\n"
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithMinimalDiff())
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, translated)
+	}
+}
+
+func TestTranslate_MinimalDiffIdentity(t *testing.T) {
+	// A model that returns its input unchanged must leave every byte of
+	// the document untouched, language attributes included.
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "test", "integration", "data", "*.xhtml"))
+	if err != nil {
+		t.Fatalf("Failed to glob files: %v", err)
+	}
+	if len(files) == 0 {
+		t.Skip("No test data found")
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		translated, _, err := service.Translate(context.Background(), strings.NewReader(string(content)), "en", "en", WithMinimalDiff())
+		if err != nil {
+			t.Fatalf("Translate of %s failed: %v", file, err)
+		}
+		if translated != string(content) {
+			t.Errorf("Output for %s differs from its input", filepath.Base(file))
+		}
+	}
+}
+
+func TestPatchStartTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		changes  map[int]string
+		add      []string
+		expected string
+	}{
+		{"unchanged", `<img  src=a.png ALT="x">`, nil, nil, `<img  src=a.png ALT="x">`},
+		{"double quoted", `<img src="a.png" alt="x">`, map[int]string{1: `y "z"`}, nil, `<img src="a.png" alt="y &quot;z&quot;">`},
+		{"single quoted", `<img alt='x' src=a.png />`, map[int]string{0: "it's"}, nil, `<img alt='it&#39;s' src=a.png />`},
+		{"unquoted", `<input value=Go type=submit>`, map[int]string{0: "Ir ya"}, nil, `<input value="Ir ya" type=submit>`},
+		{"added", `<html class="no-js" >`, nil, []string{"dir", "rtl"}, `<html class="no-js" dir="rtl" >`},
+		{"added self-closing", `<br/>`, nil, []string{"dir", "rtl"}, `<br dir="rtl"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parsePatchable(tt.tag, FormatHTML)
+			if err != nil {
+				t.Fatalf("parsePatchable failed: %v", err)
+			}
+			n := doc.root.FirstChild
+			for i, v := range tt.changes {
+				n.Attr[i].Val = v
+			}
+			if tt.add != nil {
+				n.Attr = append(n.Attr, html.Attribute{Key: tt.add[0], Val: tt.add[1]})
+			}
+			if got := patchStartTag(doc.raw[n].text, doc.raw[n].attr, n.Attr); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package translator
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// SegmentRetries reports the retried model requests of a segment.
+type SegmentRetries struct {
+	// Segment is the index of the segment in document order.
+	Segment int `json:"segment"`
+	Retries int `json:"retries"`
+}
+
+// retryCounter counts the retries of the model requests made for one
+// segment or batch.
+type retryCounter struct {
+	n atomic.Int64
+}
+
+type retryCounterKey struct{}
+
+// withRetryCounter returns ctx counting retries in rc.
+func withRetryCounter(ctx context.Context, rc *retryCounter) context.Context {
+	return context.WithValue(ctx, retryCounterKey{}, rc)
+}
+
+// RecordRetry counts a retried model request against the segment ctx was
+// passed to the LLMClient for. LLM clients that retry failed requests call
+// it for every retry, so that Metadata can report them.
+func RecordRetry(ctx context.Context) {
+	if rc, ok := ctx.Value(retryCounterKey{}).(*retryCounter); ok {
+		rc.n.Add(1)
+	}
+}
+
+// retryLog collects the retries of the segments of a Translate call.
+type retryLog struct {
+	mu      sync.Mutex
+	retries map[int]int
+}
+
+// add adds the retries counted by rc to each of segs.
+func (l *retryLog) add(rc *retryCounter, segs ...*segment) {
+	n := int(rc.n.Load())
+	if n == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.retries == nil {
+		l.retries = make(map[int]int)
+	}
+	for _, seg := range segs {
+		l.retries[seg.index] += n
+	}
+}
+
+// list returns the retries by segment, in document order, or nil if there
+// were none.
+func (l *retryLog) list() []SegmentRetries {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var list []SegmentRetries
+	for index, n := range l.retries {
+		list = append(list, SegmentRetries{Segment: index, Retries: n})
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Segment < list[b].Segment })
+	return list
+}
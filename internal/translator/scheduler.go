@@ -0,0 +1,230 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Priority is the scheduling class of a Translate call.
+type Priority string
+
+const (
+	// PriorityAuto picks PriorityInteractive for documents of at most
+	// interactiveSegments segments and PriorityBatch for larger ones.
+	PriorityAuto Priority = "auto"
+	// PriorityInteractive is served before PriorityBatch.
+	PriorityInteractive Priority = "interactive"
+	// PriorityBatch gets the slots interactive calls leave, and at least
+	// one in batchShare when both are waiting.
+	PriorityBatch Priority = "batch"
+)
+
+// interactiveSegments is the largest document, in segments, PriorityAuto
+// treats as interactive.
+const interactiveSegments = 20
+
+// batchShare guarantees batch calls one model request slot in batchShare
+// while interactive calls are waiting too, so they are never starved.
+const batchShare = 4
+
+// DefaultConcurrency is the number of concurrent model requests of a
+// Scheduler created by NewService.
+const DefaultConcurrency = 5
+
+// ParsePriority parses a priority name. The empty string means
+// PriorityAuto.
+func ParsePriority(s string) (Priority, error) {
+	switch p := Priority(s); p {
+	case "":
+		return PriorityAuto, nil
+	case PriorityAuto, PriorityInteractive, PriorityBatch:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown priority %q (want auto, interactive or batch)", s)
+}
+
+// WithPriority sets the scheduling class of the call. The default is
+// PriorityAuto.
+func WithPriority(p Priority) Option {
+	return func(o *options) {
+		o.priority = p
+	}
+}
+
+// Scheduler limits the model requests of all the Translate calls sharing
+// it. Requests wait in one queue per call; free slots go to the queues in
+// turn, so a large document cannot hold up the others, and to interactive
+// calls before batch calls. Its limit is fixed, or adapts to the model
+// server if it was created with NewAdaptiveScheduler.
+type Scheduler struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	// ready holds, per class, the queues with waiting requests, in the
+	// order they are served.
+	interactive, batch []*queue
+	// grants counts the slots given out while both classes were waiting.
+	grants int
+	// adaptive, if not nil, tunes limit to the latency of the model
+	// server.
+	adaptive *aimd
+	latency  latencyLog
+}
+
+// NewScheduler returns a Scheduler allowing limit concurrent model
+// requests.
+func NewScheduler(limit int) *Scheduler {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Scheduler{limit: limit}
+}
+
+// WithScheduler sets the Scheduler of the service's model requests, which
+// may be shared with other services. NewService creates one allowing
+// DefaultConcurrency requests.
+func WithScheduler(s *Scheduler) ServiceOption {
+	return func(svc *Service) {
+		svc.scheduler = s
+	}
+}
+
+// queue holds the waiting model requests of one Translate call.
+type queue struct {
+	s        *Scheduler
+	priority Priority
+	waiting  []*waiter
+}
+
+// waiter is a model request waiting for a slot.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// newQueue returns a queue for the requests of a call of priority p,
+// PriorityInteractive or PriorityBatch.
+func (s *Scheduler) newQueue(p Priority) *queue {
+	return &queue{s: s, priority: p}
+}
+
+// acquire waits for a slot for a model request. The slot must be given
+// back with release.
+func (q *queue) acquire(ctx context.Context) error {
+	s := q.s
+	s.mu.Lock()
+	if s.running < s.limit && len(s.interactive) == 0 && len(s.batch) == 0 {
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	if len(q.waiting) == 0 {
+		s.enqueue(q)
+	}
+	q.waiting = append(q.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.granted {
+			// The slot was granted as ctx ended; pass it on.
+			s.running--
+			s.dispatch()
+		} else {
+			q.remove(w)
+		}
+		return ctx.Err()
+	}
+}
+
+// release gives back a slot obtained with acquire.
+func (q *queue) release() {
+	s := q.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.dispatch()
+}
+
+// enqueue appends q to the ready queues of its class.
+func (s *Scheduler) enqueue(q *queue) {
+	if q.priority == PriorityInteractive {
+		s.interactive = append(s.interactive, q)
+	} else {
+		s.batch = append(s.batch, q)
+	}
+}
+
+// remove drops w from the queue, and the queue from the ready queues if it
+// has no more waiting requests.
+func (q *queue) remove(w *waiter) {
+	for i, x := range q.waiting {
+		if x == w {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	if len(q.waiting) > 0 {
+		return
+	}
+	ready := &q.s.batch
+	if q.priority == PriorityInteractive {
+		ready = &q.s.interactive
+	}
+	for i, x := range *ready {
+		if x == q {
+			*ready = append((*ready)[:i], (*ready)[i+1:]...)
+			break
+		}
+	}
+}
+
+// waiting returns the number of requests waiting for a slot.
+func (s *Scheduler) waiting() int {
+	n := 0
+	for _, q := range s.interactive {
+		n += len(q.waiting)
+	}
+	for _, q := range s.batch {
+		n += len(q.waiting)
+	}
+	return n
+}
+
+// dispatch hands free slots to waiting requests: to the next interactive
+// queue in turn, except for every batchShare-th slot given out while batch
+// requests wait too, which goes to the next batch queue.
+func (s *Scheduler) dispatch() {
+	for s.running < s.limit {
+		ready := &s.interactive
+		switch {
+		case len(s.interactive) == 0 && len(s.batch) == 0:
+			return
+		case len(s.interactive) == 0:
+			ready = &s.batch
+		case len(s.batch) > 0:
+			s.grants++
+			if s.grants%batchShare == 0 {
+				ready = &s.batch
+			}
+		}
+
+		q := (*ready)[0]
+		*ready = (*ready)[1:]
+		w := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		if len(q.waiting) > 0 {
+			// Back of the line until the other queues had their turn.
+			*ready = append(*ready, q)
+		}
+		w.granted = true
+		close(w.ready)
+		s.running++
+	}
+}
@@ -0,0 +1,148 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// grantOrder queues the requests of queues, named by their keys, in the
+// order given while s is saturated, and returns the order in which they are
+// granted a slot.
+func grantOrder(t *testing.T, s *Scheduler, hold *queue, requests []string, queues map[string]*queue) []string {
+	t.Helper()
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, name := range requests {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			q := queues[name]
+			if err := q.acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			q.release()
+		}(name)
+		for s.Stats().Waiting != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	hold.release()
+	wg.Wait()
+	return order
+}
+
+func TestScheduler_RoundRobin(t *testing.T) {
+	s := NewScheduler(1)
+	hold := s.newQueue(PriorityBatch)
+	hold.acquire(context.Background())
+
+	queues := map[string]*queue{"a": s.newQueue(PriorityBatch), "b": s.newQueue(PriorityBatch)}
+	order := grantOrder(t, s, hold, []string{"a", "a", "a", "b", "b", "b"}, queues)
+	if got := strings.Join(order, ""); got != "ababab" {
+		t.Errorf("Expected the queues served in turn, got %s", got)
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	s := NewScheduler(1)
+	hold := s.newQueue(PriorityBatch)
+	hold.acquire(context.Background())
+
+	queues := map[string]*queue{"b": s.newQueue(PriorityBatch), "i": s.newQueue(PriorityInteractive)}
+	order := grantOrder(t, s, hold, []string{"b", "b", "b", "i", "i", "i", "i", "i", "i"}, queues)
+	// Interactive requests go first, but batch requests get one slot in
+	// batchShare.
+	if got := strings.Join(order, ""); got != "iiibiiibb" {
+		t.Errorf("Unexpected order %s", got)
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	s := NewScheduler(1)
+	hold := s.newQueue(PriorityBatch)
+	hold.acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := s.newQueue(PriorityInteractive)
+	done := make(chan error)
+	go func() { done <- q.acquire(ctx) }()
+	for s.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if n := s.Stats().Waiting; n != 0 {
+		t.Errorf("Expected the cancelled request to leave the queue, %d waiting", n)
+	}
+
+	hold.release()
+	if err := q.acquire(context.Background()); err != nil {
+		t.Errorf("Expected the slot to be free: %v", err)
+	}
+}
+
+func TestScheduler_SharedLimit(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+			return text, nil
+		},
+	}
+	service := NewService(mockLLM, WithScheduler(NewScheduler(3)))
+
+	input := strings.Repeat("<p>Text</p>", 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxActive > 3 {
+		t.Errorf("Expected at most 3 concurrent requests across calls, got %d", maxActive)
+	}
+}
+
+func TestTranslate_AutoPriority(t *testing.T) {
+	service := NewService(&MockLLM{ModelName: "test-model"})
+	tests := map[int]Priority{1: PriorityInteractive, interactiveSegments: PriorityInteractive, interactiveSegments + 1: PriorityBatch}
+	for n, want := range tests {
+		_, metadata, err := service.Translate(context.Background(), strings.NewReader(strings.Repeat("<p>Text</p>", n)), "en", "es")
+		if err != nil {
+			t.Fatalf("Translate failed: %v", err)
+		}
+		if metadata.Priority != want {
+			t.Errorf("Expected priority %s for %d segments, got %s", want, n, metadata.Priority)
+		}
+	}
+	_, metadata, _ := service.Translate(context.Background(), strings.NewReader("<p>Text</p>"), "en", "es", WithPriority(PriorityBatch))
+	if metadata.Priority != PriorityBatch {
+		t.Errorf("Expected the requested priority, got %s", metadata.Priority)
+	}
+}
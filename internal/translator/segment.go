@@ -0,0 +1,451 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// inlineElements flow within a line of text. A run of text and inline
+// elements is translated as a single segment so the model sees whole
+// sentences instead of fragments.
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "big": true,
+	"br": true, "cite": true, "code": true, "data": true, "del": true, "dfn": true,
+	"em": true, "font": true, "i": true, "img": true, "ins": true, "kbd": true,
+	"label": true, "mark": true, "q": true, "s": true, "samp": true, "small": true,
+	"span": true, "strong": true, "sub": true, "sup": true, "time": true, "tt": true,
+	"u": true, "var": true, "wbr": true,
+}
+
+// placeholderPattern matches the markers standing in for inline markup:
+// <g1>…</g1> wraps translatable content, <x2/> replaces an element that
+// is kept as-is (line breaks, images, comments, scripts, untranslatable
+// elements).
+var placeholderPattern = regexp.MustCompile(`<(/?)([gx])(\d+)(/?)>`)
+
+// errPlaceholders is returned when a translation does not contain the
+// placeholders of its source segment exactly once and properly nested.
+var errPlaceholders = errors.New("translation does not preserve inline placeholders")
+
+// segment is one unit of text sent to the model.
+type segment struct {
+	source string
+	// apply writes the translation back into the document.
+	apply func(translated string) error
+	// check, if set, reports whether apply would reject the translation,
+	// without changing the document.
+	check func(translated string) error
+	// fallback holds finer-grained segments covering the same content,
+	// translated one by one when apply rejects the translation.
+	fallback []*segment
+	// dups holds the later segments with the same text, which take the
+	// translation of this one.
+	dups []*segment
+	// slots holds the text masked out of source into slot markers, which
+	// is filled back into the translation. slotRetry is set on the copy
+	// of a segment translated again after its translation lost a marker.
+	slots     []string
+	slotRetry bool
+	// termRetry is set on the copy of a segment translated again after its
+	// translation missed a glossary term.
+	termRetry bool
+	// rejectRetry is set on the copy of a segment translated again after
+	// the Validator rejected its translation.
+	rejectRetry bool
+	// verbatim is set on segments left without letters to translate once
+	// their slots are masked; they keep their source text.
+	verbatim bool
+	// context is the text around the segment, given to the model to
+	// resolve ambiguities.
+	context string
+	// index is the position of the segment in document order; fallback
+	// segments share the index of their segment.
+	index int
+	// node is the element holding the segment, and attr the name of the
+	// attribute for attribute segments.
+	node *html.Node
+	attr string
+}
+
+// maxContextRunes caps the length of each neighbour in a segment's context.
+const maxContextRunes = 200
+
+// setContext sets the context of each segment to the text of the segments
+// before and after it, without placeholders. Fallback segments share the
+// context of their segment.
+func setContext(segs []*segment) {
+	neighbour := func(i int) string {
+		if i < 0 || i >= len(segs) {
+			return ""
+		}
+		text := strings.Join(strings.Fields(placeholderPattern.ReplaceAllString(segs[i].source, "")), " ")
+		if r := []rune(text); len(r) > maxContextRunes {
+			text = string(r[:maxContextRunes]) + "…"
+		}
+		return text
+	}
+	for i, seg := range segs {
+		var parts []string
+		for _, text := range []string{neighbour(i - 1), neighbour(i + 1)} {
+			if text != "" {
+				parts = append(parts, text)
+			}
+		}
+		seg.context = strings.Join(parts, "\n")
+		for _, fb := range seg.fallback {
+			fb.context = seg.context
+		}
+	}
+}
+
+// collector extracts the segments of a document.
+type collector struct {
+	skip []Selector
+}
+
+// collectSegments walks the document and returns its translatable
+// segments, leaving out content excluded by the skip selectors, the
+// translate attribute or the notranslate class.
+func collectSegments(doc *html.Node, skip []Selector) []*segment {
+	c := &collector{skip: skip}
+	return c.walk(nil, doc, true)
+}
+
+// walk appends the segments under n to segs. translate reports whether the
+// content of n is translatable.
+func (c *collector) walk(segs []*segment, n *html.Node, translate bool) []*segment {
+	var run []*html.Node
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if translate && c.isInlineContent(ch) {
+			run = append(run, ch)
+			continue
+		}
+		segs = append(segs, c.runSegments(run)...)
+		run = nil
+		if ch.Type == html.ElementNode {
+			// Excluded elements are still walked: a descendant may opt
+			// back in with translate="yes".
+			segs = c.walk(segs, ch, translatable(ch, translate, c.skip))
+		}
+	}
+	return append(segs, c.runSegments(run)...)
+}
+
+// opaque reports whether n is an element excluded from translation inside
+// translatable content. Opaque elements are kept as-is, as placeholders.
+func (c *collector) opaque(n *html.Node) bool {
+	return n.Type == html.ElementNode && !translatable(n, true, c.skip)
+}
+
+// isInlineContent reports whether n can be folded into a run of inline
+// content: text, comments, and inline elements whose descendants are all
+// inline content themselves.
+func (c *collector) isInlineContent(n *html.Node) bool {
+	switch n.Type {
+	case html.TextNode, html.CommentNode:
+		return true
+	case html.ElementNode:
+		if !inlineElements[n.Data] {
+			// Scripts and the like inside a paragraph do not break it up.
+			return rawTextElements[n.Data]
+		}
+		if c.opaque(n) {
+			return true
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if !c.isInlineContent(ch) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// hasText reports whether n carries translatable text.
+func (c *collector) hasText(n *html.Node) bool {
+	switch n.Type {
+	case html.TextNode:
+		return strings.TrimSpace(n.Data) != ""
+	case html.ElementNode:
+		if c.opaque(n) {
+			return false
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if c.hasText(ch) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runSegments builds the segments for a run of sibling inline nodes. Nodes
+// without text at either end of the run are left out of it.
+func (c *collector) runSegments(run []*html.Node) []*segment {
+	run = c.trimRun(run)
+	// A run made of a single element, as in <li><a>Home</a></li>, needs
+	// no placeholders: translate the element's content instead.
+	for len(run) == 1 && run[0].Type == html.ElementNode {
+		var children []*html.Node
+		for ch := run[0].FirstChild; ch != nil; ch = ch.NextSibling {
+			children = append(children, ch)
+		}
+		run = c.trimRun(children)
+	}
+	if len(run) == 0 {
+		return nil
+	}
+	if len(run) == 1 && run[0].Type == html.TextNode {
+		return []*segment{textSegment(run[0])}
+	}
+
+	var texts []*html.Node
+	for _, n := range run {
+		texts = c.appendTextNodes(texts, n)
+	}
+	fallback := make([]*segment, 0, len(texts))
+	for _, t := range texts {
+		fallback = append(fallback, textSegment(t))
+	}
+
+	seg := c.newInlineSegment(run)
+	if seg == nil {
+		// The text already contains something that looks like our
+		// placeholders, so translate node by node instead.
+		return fallback
+	}
+	seg.fallback = fallback
+	return []*segment{seg}
+}
+
+// trimRun drops the nodes without text at either end of run.
+func (c *collector) trimRun(run []*html.Node) []*html.Node {
+	for len(run) > 0 && !c.hasText(run[0]) {
+		run = run[1:]
+	}
+	for len(run) > 0 && !c.hasText(run[len(run)-1]) {
+		run = run[:len(run)-1]
+	}
+	return run
+}
+
+// appendTextNodes appends the translatable text nodes under n to dst.
+func (c *collector) appendTextNodes(dst []*html.Node, n *html.Node) []*html.Node {
+	if n.Type == html.TextNode {
+		if strings.TrimSpace(n.Data) != "" {
+			dst = append(dst, n)
+		}
+		return dst
+	}
+	if c.opaque(n) {
+		return dst
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		dst = c.appendTextNodes(dst, ch)
+	}
+	return dst
+}
+
+// textSegment translates a single text node.
+func textSegment(n *html.Node) *segment {
+	return &segment{
+		source: n.Data,
+		apply: func(translated string) error {
+			n.Data = translated
+			return nil
+		},
+		node: n.Parent,
+	}
+}
+
+// placeholderKind distinguishes the two kinds of inline placeholders.
+type placeholderKind byte
+
+const (
+	pairedPlaceholder placeholderKind = 'g'
+	emptyPlaceholder  placeholderKind = 'x'
+)
+
+// inlineSegment is a run of inline content encoded with placeholders.
+type inlineSegment struct {
+	run   []*html.Node
+	refs  map[int]*html.Node
+	kinds map[int]placeholderKind
+	// texts are the text nodes of the run, reused for pieces of text the
+	// translation leaves unchanged.
+	texts []*html.Node
+}
+
+// newInlineSegment encodes run as text with numbered placeholders. It
+// returns nil if the text itself contains placeholder-like markers.
+func (c *collector) newInlineSegment(run []*html.Node) *segment {
+	is := &inlineSegment{
+		run:   run,
+		refs:  make(map[int]*html.Node),
+		kinds: make(map[int]placeholderKind),
+	}
+	var b strings.Builder
+	ok := true
+	var encode func(*html.Node)
+	encode = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			if placeholderPattern.MatchString(n.Data) {
+				ok = false
+			}
+			is.texts = append(is.texts, n)
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && !c.opaque(n) && n.FirstChild != nil:
+			id := len(is.refs) + 1
+			is.refs[id], is.kinds[id] = n, pairedPlaceholder
+			fmt.Fprintf(&b, "<g%d>", id)
+			for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+				encode(ch)
+			}
+			fmt.Fprintf(&b, "</g%d>", id)
+		default:
+			id := len(is.refs) + 1
+			is.refs[id], is.kinds[id] = n, emptyPlaceholder
+			fmt.Fprintf(&b, "<x%d/>", id)
+		}
+	}
+	for _, n := range run {
+		encode(n)
+	}
+	if !ok {
+		return nil
+	}
+	return &segment{source: b.String(), apply: is.apply, check: is.check, node: run[0].Parent}
+}
+
+// placeholderToken is a piece of a translated inline segment: either text
+// or a placeholder marker.
+type placeholderToken struct {
+	text  string
+	id    int
+	kind  placeholderKind
+	close bool
+}
+
+// parsePlaceholders splits translated into text and placeholder tokens and
+// checks that every placeholder of the segment appears exactly once with
+// its original kind and that paired placeholders nest properly.
+func (is *inlineSegment) parsePlaceholders(translated string) ([]placeholderToken, error) {
+	var tokens []placeholderToken
+	seen := make(map[int]bool)
+	var open []int
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(translated, -1) {
+		if m[0] > last {
+			tokens = append(tokens, placeholderToken{text: translated[last:m[0]]})
+		}
+		last = m[1]
+
+		closing := m[3] > m[2]
+		kind := placeholderKind(translated[m[4]])
+		selfClosing := m[9] > m[8]
+		id, err := strconv.Atoi(translated[m[6]:m[7]])
+		if err != nil || is.kinds[id] != kind {
+			return nil, errPlaceholders
+		}
+
+		switch {
+		case kind == emptyPlaceholder && !closing && selfClosing:
+			if seen[id] {
+				return nil, errPlaceholders
+			}
+			seen[id] = true
+		case kind == pairedPlaceholder && !closing && !selfClosing:
+			if seen[id] {
+				return nil, errPlaceholders
+			}
+			seen[id] = true
+			open = append(open, id)
+		case kind == pairedPlaceholder && closing && !selfClosing:
+			if len(open) == 0 || open[len(open)-1] != id {
+				return nil, errPlaceholders
+			}
+			open = open[:len(open)-1]
+		default:
+			return nil, errPlaceholders
+		}
+		tokens = append(tokens, placeholderToken{id: id, kind: kind, close: closing})
+	}
+	if last < len(translated) {
+		tokens = append(tokens, placeholderToken{text: translated[last:]})
+	}
+	if len(open) > 0 || len(seen) != len(is.refs) {
+		return nil, errPlaceholders
+	}
+	return tokens, nil
+}
+
+// check validates the placeholders of the translation.
+func (is *inlineSegment) check(translated string) error {
+	_, err := is.parsePlaceholders(translated)
+	return err
+}
+
+// apply validates the translation and rebuilds the inline markup in the
+// translated order, reusing the original elements for each placeholder.
+func (is *inlineSegment) apply(translated string) error {
+	tokens, err := is.parsePlaceholders(translated)
+	if err != nil {
+		return err
+	}
+
+	parent := is.run[0].Parent
+	anchor := is.run[len(is.run)-1].NextSibling
+	for _, n := range is.run {
+		parent.RemoveChild(n)
+	}
+	for id, n := range is.refs {
+		if is.kinds[id] != pairedPlaceholder {
+			continue
+		}
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+		}
+	}
+
+	unchanged := make(map[string][]*html.Node)
+	for _, n := range is.texts {
+		unchanged[n.Data] = append(unchanged[n.Data], n)
+	}
+
+	stack := []*html.Node{nil}
+	add := func(n *html.Node) {
+		if top := stack[len(stack)-1]; top != nil {
+			top.AppendChild(n)
+		} else {
+			parent.InsertBefore(n, anchor)
+		}
+	}
+	for _, tok := range tokens {
+		switch {
+		case tok.id == 0:
+			if reuse := unchanged[tok.text]; len(reuse) > 0 {
+				// Keeping the original node preserves its source bytes
+				// in minimal-diff output.
+				unchanged[tok.text] = reuse[1:]
+				add(reuse[0])
+			} else {
+				add(&html.Node{Type: html.TextNode, Data: tok.text})
+			}
+		case tok.close:
+			stack = stack[:len(stack)-1]
+		case tok.kind == pairedPlaceholder:
+			add(is.refs[tok.id])
+			stack = append(stack, is.refs[tok.id])
+		default:
+			add(is.refs[tok.id])
+		}
+	}
+	return nil
+}
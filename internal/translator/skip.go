@@ -0,0 +1,205 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// rawTextElements hold content that is never sent to the model, whatever
+// the translate attribute says.
+var rawTextElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"template": true,
+}
+
+// DefaultSkipSelectors leaves code samples untranslated. Elements with
+// translate="no" or class="notranslate" are always skipped.
+var DefaultSkipSelectors = MustParseSelectors("code, pre, kbd, samp, var")
+
+// Selector is a CSS-like compound selector: an optional element name (or
+// "*") followed by any number of #id, .class, [attr] and [attr=value]
+// conditions, as in "span.brand" or "div[data-lang=en]".
+type Selector struct {
+	element string
+	id      string
+	classes []string
+	attrs   []attributeSelector
+}
+
+// attributeSelector is an [attr] or [attr=value] condition.
+type attributeSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// ParseSelectors parses a comma-separated list of selectors.
+func ParseSelectors(s string) ([]Selector, error) {
+	var selectors []Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		sel, err := parseSelector(part)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+	}
+	return selectors, nil
+}
+
+// MustParseSelectors is like ParseSelectors but panics if s is invalid.
+func MustParseSelectors(s string) []Selector {
+	selectors, err := ParseSelectors(s)
+	if err != nil {
+		panic(err)
+	}
+	return selectors
+}
+
+func parseSelector(s string) (Selector, error) {
+	var sel Selector
+	isNameChar := func(c byte) bool {
+		return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+	}
+	name := func(i int) (string, int) {
+		j := i
+		for j < len(s) && isNameChar(s[j]) {
+			j++
+		}
+		return s[i:j], j
+	}
+
+	i := 0
+	if i < len(s) && s[i] == '*' {
+		i++
+	} else if i < len(s) && isNameChar(s[i]) {
+		sel.element, i = name(i)
+		sel.element = strings.ToLower(sel.element)
+	}
+	for i < len(s) {
+		var n string
+		switch s[i] {
+		case '#':
+			n, i = name(i + 1)
+			if n == "" {
+				return Selector{}, fmt.Errorf("invalid selector %q: empty id", s)
+			}
+			sel.id = n
+		case '.':
+			n, i = name(i + 1)
+			if n == "" {
+				return Selector{}, fmt.Errorf("invalid selector %q: empty class", s)
+			}
+			sel.classes = append(sel.classes, n)
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return Selector{}, fmt.Errorf("invalid selector %q: unterminated attribute condition", s)
+			}
+			cond := s[i+1 : i+end]
+			i += end + 1
+			key, value, hasValue := strings.Cut(cond, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "" {
+				return Selector{}, fmt.Errorf("invalid selector %q: empty attribute name", s)
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			sel.attrs = append(sel.attrs, attributeSelector{key: key, value: value, hasValue: hasValue})
+		default:
+			return Selector{}, fmt.Errorf("invalid selector %q: unexpected %q", s, s[i])
+		}
+	}
+	return sel, nil
+}
+
+// String returns the selector in CSS syntax.
+func (sel Selector) String() string {
+	var b strings.Builder
+	b.WriteString(sel.element)
+	if sel.id != "" {
+		b.WriteString("#" + sel.id)
+	}
+	for _, c := range sel.classes {
+		b.WriteString("." + c)
+	}
+	for _, a := range sel.attrs {
+		b.WriteString("[" + a.key)
+		if a.hasValue {
+			b.WriteString(`="` + a.value + `"`)
+		}
+		b.WriteString("]")
+	}
+	if b.Len() == 0 {
+		return "*"
+	}
+	return b.String()
+}
+
+// matches reports whether element n matches the selector.
+func (sel Selector) matches(n *html.Node) bool {
+	if sel.element != "" && sel.element != n.Data {
+		return false
+	}
+	if sel.id != "" {
+		if id, ok := attr(n, "id"); !ok || id != sel.id {
+			return false
+		}
+	}
+	for _, c := range sel.classes {
+		if !hasClass(n, c) {
+			return false
+		}
+	}
+	for _, a := range sel.attrs {
+		v, ok := attr(n, a.key)
+		if !ok || a.hasValue && v != a.value {
+			return false
+		}
+	}
+	return true
+}
+
+// hasClass reports whether n has class in its class attribute.
+func hasClass(n *html.Node, class string) bool {
+	classes, _ := attr(n, "class")
+	for _, c := range strings.Fields(classes) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// translatable reports whether the content of element n is translated,
+// given whether its parent's content is. Following the HTML translate
+// attribute, translate="yes" re-enables translation below an excluded
+// ancestor, while translate="no", the "notranslate" class and the skip
+// selectors exclude an element and, by inheritance, its descendants.
+func translatable(n *html.Node, inherited bool, skip []Selector) bool {
+	if rawTextElements[n.Data] {
+		return false
+	}
+	if v, ok := attr(n, "translate"); ok {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "no":
+			return false
+		case "", "yes":
+			return true
+		}
+	}
+	if hasClass(n, "notranslate") {
+		return false
+	}
+	for _, sel := range skip {
+		if sel.matches(n) {
+			return false
+		}
+	}
+	return inherited
+}
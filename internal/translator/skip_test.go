@@ -0,0 +1,97 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTranslate_Skip(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return "TR:" + text, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		skip     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "translate attribute",
+			input:    `<div translate="no"><p>Acme <b>Cloud</b></p></div><p>Hello</p>`,
+			expected: `<div translate="no"><p>Acme <b>Cloud</b></p></div><p>TR:Hello</p>`,
+		},
+		{
+			name:     "translate yes below no",
+			input:    `<div translate="no"><p>Keep</p><p translate="yes">Change</p></div>`,
+			expected: `<div translate="no"><p>Keep</p><p translate="yes">TR:Change</p></div>`,
+		},
+		{
+			name:     "notranslate class at any depth",
+			input:    `<section class="card notranslate"><div><p title="Tip">Acme Corp</p></div></section>`,
+			expected: `<section class="card notranslate"><div><p title="Tip">Acme Corp</p></div></section>`,
+		},
+		{
+			name:     "inline exclusion becomes placeholder",
+			input:    `<p>Run <code>go test</code> to check <span translate="no">Acme</span>.</p>`,
+			expected: `<p>TR:Run <code>go test</code> to check <span translate="no">Acme</span>.</p>`,
+		},
+		{
+			name:     "default pre",
+			input:    `<pre>x := 1</pre><p>Text</p>`,
+			expected: `<pre>x := 1</pre><p>TR:Text</p>`,
+		},
+		{
+			name:     "configured selectors",
+			skip:     "address, span.brand, [data-raw]",
+			input:    `<address>1 Main St</address><p>Buy <span class="brand">Acme</span> now</p><div data-raw=""><p>Raw</p></div><pre>Code</pre>`,
+			expected: `<address>1 Main St</address><p>TR:Buy <span class="brand">Acme</span> now</p><div data-raw=""><p>Raw</p></div><pre>TR:Code</pre>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []ServiceOption
+			if tt.skip != "" {
+				selectors, err := ParseSelectors(tt.skip)
+				if err != nil {
+					t.Fatalf("ParseSelectors failed: %v", err)
+				}
+				opts = append(opts, WithSkipSelectors(selectors))
+			}
+			service := NewService(mockLLM, opts...)
+
+			translated, _, err := service.Translate(context.Background(), strings.NewReader(tt.input), "en", "es", WithFragment(""))
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if translated != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, translated)
+			}
+		})
+	}
+}
+
+func TestParseSelectors(t *testing.T) {
+	selectors, err := ParseSelectors(`code, span.brand.x, #main, [data-lang="en"], *[hidden], div#a.b[c=d]`)
+	if err != nil {
+		t.Fatalf("ParseSelectors failed: %v", err)
+	}
+	var got []string
+	for _, sel := range selectors {
+		got = append(got, sel.String())
+	}
+	expected := `code|span.brand.x|#main|[data-lang="en"]|[hidden]|div#a.b[c="d"]`
+	if strings.Join(got, "|") != expected {
+		t.Errorf("Expected %q, got %q", expected, strings.Join(got, "|"))
+	}
+
+	for _, bad := range []string{"div > p", ".", "#", "[x", "[=y]", "p:first-child"} {
+		if _, err := ParseSelectors(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// numberPattern matches times ("6:45 pm", "10am"), numeric dates
+// ("2024-07-04", "7/4/2024") and numbers with an optional symbolic unit
+// ("68", "0.25", "1,200", "40%", "75°F", "10 mph"). Units spelled out as
+// words are left to the model to translate.
+var numberPattern = regexp.MustCompile(`(?i)` +
+	`\d{1,2}:\d{2}(?::\d{2})?(?:\s?(?:[ap]m\b|[ap]\.m\.))?` +
+	`|\d{1,2}\s?(?:[ap]m\b|[ap]\.m\.)` +
+	`|\d{4}-\d{2}-\d{2}|\d{1,2}/\d{1,2}/\d{2,4}` +
+	`|\d+(?:[.,]\d+)*(?:\s?(?:%|°[FC]?|(?:mph|km/h|kph|kts?|mm|cm|hPa|mb)\b))?`)
+
+// DefaultProtectedPatterns match the spans WithProtectedPatterns keeps out
+// of the model's reach in addition to its own: numbers, times, dates and
+// units as numberPattern, times with their time zone ("4:00 PM CDT"), URLs,
+// email addresses, codes mixing capitals and digits ("I-55", "KS123") and
+// format placeholders ("{name}", "{{name}}", "${name}", "%s", "%(name)s").
+var DefaultProtectedPatterns = []*regexp.Regexp{
+	numberPattern,
+	regexp.MustCompile(`\d{1,2}(?::\d{2})?\s?(?i:[ap]m|[ap]\.m\.)\s(?:[A-Z]{1,2}[SDP]?T|UTC|GMT)\b`),
+	regexp.MustCompile(`(?i)(?:https?://|www\.)[^\s<>"']*[^\s<>"'.,;:!?)]`),
+	regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`),
+	regexp.MustCompile(`\b[A-Z]{1,4}-?\d+[A-Z0-9]*(?:-[A-Z0-9]+)*\b`),
+	regexp.MustCompile(`\{\{\s*[\w.]+\s*\}\}|\$\{[\w.]+\}|\{[\w.]*\}|%(?:\(\w+\))?[sdif]`),
+}
+
+// slotMarkerPattern matches the markers standing in for masked spans, or
+// slots: <n1/>, <n2/>, ...
+var slotMarkerPattern = regexp.MustCompile(`<n(\d+)/>`)
+
+// errSlots is returned when a translation does not contain the slot
+// markers of its source exactly once each.
+var errSlots = errors.New("translation does not preserve slot markers")
+
+// WithTemplateSlots masks the numbers, times, dates and units of every
+// segment into numbered slot markers before sending it to the model, and
+// refills them in the translation. Sentences differing only in numbers
+// share a template, which is translated once per document, and the
+// numbers cannot be altered by the model. Segments left without letters to
+// translate, such as "75°F" on its own, keep their text without a model
+// call. Segments whose translation loses a marker are translated again,
+// then with their numbers.
+func WithTemplateSlots() ServiceOption {
+	return func(s *Service) {
+		s.masks = append(s.masks, numberPattern)
+	}
+}
+
+// WithProtectedPatterns masks the spans matched by DefaultProtectedPatterns
+// and patterns into slot markers before sending text to the model, and
+// restores them in the translation, so that the model cannot alter them.
+// Segments left without letters to translate, such as a URL on its own,
+// keep their text without a model call. Segments whose translation loses
+// or repeats a marker are translated again, then translated piece by
+// piece around their inline elements if they have any, and fail
+// otherwise.
+func WithProtectedPatterns(patterns ...*regexp.Regexp) ServiceOption {
+	return func(s *Service) {
+		s.masks = append(append(s.masks, DefaultProtectedPatterns...), patterns...)
+		s.protect = true
+	}
+}
+
+// maskSpans returns text with the spans matched by patterns replaced by
+// slot markers, and the masked spans in order. Where matches overlap, the
+// one starting first, then the longest, is masked. Inline placeholders are
+// left untouched. It returns nil slots if text has none or contains slot
+// markers already.
+func maskSpans(text string, patterns []*regexp.Regexp) (string, []string) {
+	if slotMarkerPattern.MatchString(text) {
+		return text, nil
+	}
+	var b strings.Builder
+	var slots []string
+	last := 0
+	mask := func(end int) {
+		s := text[last:end]
+		prev := 0
+		for _, m := range slotMatches(s, patterns) {
+			if m[0] < prev {
+				continue
+			}
+			b.WriteString(s[prev:m[0]])
+			slots = append(slots, s[m[0]:m[1]])
+			fmt.Fprintf(&b, "<n%d/>", len(slots))
+			prev = m[1]
+		}
+		b.WriteString(s[prev:])
+	}
+	for _, m := range placeholderPattern.FindAllStringIndex(text, -1) {
+		mask(m[0])
+		b.WriteString(text[m[0]:m[1]])
+		last = m[1]
+	}
+	mask(len(text))
+
+	if len(slots) == 0 {
+		return text, nil
+	}
+	return b.String(), slots
+}
+
+// hasLetters reports whether masked has letters outside its placeholders
+// and slot markers.
+func hasLetters(masked string) bool {
+	return strings.ContainsFunc(slotMarkerPattern.ReplaceAllString(placeholderPattern.ReplaceAllString(masked, ""), ""), unicode.IsLetter)
+}
+
+// slotMatches returns the matches of patterns in s that are not part of a
+// word, ordered by start, then longest first.
+func slotMatches(s string, patterns []*regexp.Regexp) [][]int {
+	var matches [][]int
+	for _, p := range patterns {
+		for _, m := range p.FindAllStringIndex(s, -1) {
+			// Digits within words, such as "H2O" or "1st", are part of
+			// the word.
+			if r, _ := utf8.DecodeLastRuneInString(s[:m[0]]); m[0] > 0 && isWordRune(r) {
+				continue
+			}
+			if r, _ := utf8.DecodeRuneInString(s[m[1]:]); m[1] < len(s) && isWordRune(r) {
+				continue
+			}
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a][0] != matches[b][0] {
+			return matches[a][0] < matches[b][0]
+		}
+		return matches[a][1] > matches[b][1]
+	})
+	return matches
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// checkSlots returns errSlots unless translated contains the markers of n
+// slots exactly once each.
+func checkSlots(translated string, n int) error {
+	seen := make([]bool, n)
+	for _, m := range slotMarkerPattern.FindAllStringSubmatch(translated, -1) {
+		i, _ := strconv.Atoi(m[1])
+		if i < 1 || i > n || seen[i-1] {
+			return errSlots
+		}
+		seen[i-1] = true
+	}
+	for _, ok := range seen {
+		if !ok {
+			return errSlots
+		}
+	}
+	return nil
+}
+
+// fillSlots returns translated with its slot markers replaced by slots. It
+// returns errSlots if a marker is missing, repeated or unknown.
+func fillSlots(translated string, slots []string) (string, error) {
+	if err := checkSlots(translated, len(slots)); err != nil {
+		return "", err
+	}
+	return slotMarkerPattern.ReplaceAllStringFunc(translated, func(marker string) string {
+		n, _ := strconv.Atoi(slotMarkerPattern.FindStringSubmatch(marker)[1])
+		return slots[n-1]
+	}), nil
+}
+
+// maskSegments masks the spans matched by patterns in the core text of
+// each of segs and of their fallback segments. Segments that masking would
+// leave without letters to translate are marked verbatim.
+func maskSegments(segs []*segment, patterns []*regexp.Regexp) {
+	for _, seg := range segs {
+		maskSegments(seg.fallback, patterns)
+		lead, core, trail := splitSpace(seg.source)
+		masked, slots := maskSpans(core, patterns)
+		if slots == nil {
+			continue
+		}
+		if !hasLetters(masked) {
+			seg.verbatim = true
+			continue
+		}
+		seg.source = lead + masked + trail
+		seg.slots = slots
+	}
+}
+
+// slotsLost handles a translation of seg that lost or repeated slot
+// markers: the segment and its duplicates are translated once more,
+// bypassing stored translations. If that fails too, each of them falls back
+// to its fallback segments if its slots are protected, and is translated
+// with its slots filled in otherwise.
+func (j *job) slotsLost(ctx context.Context, seg *segment) error {
+	if !seg.slotRetry {
+		retry := *seg
+		retry.slotRetry = true
+		return j.translateSegment(withMemoryRefresh(ctx), &retry)
+	}
+	group := append([]*segment{seg}, seg.dups...)
+	if j.service.protect {
+		return j.fallBack(ctx, errSlots, group...)
+	}
+	for _, s := range group {
+		plain := s.single()
+		plain.source, _ = fillSlots(s.source, s.slots)
+		plain.slots = nil
+		if err := j.translateSegment(ctx, plain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// single returns a copy of seg without duplicates.
+func (seg *segment) single() *segment {
+	s := *seg
+	s.dups = nil
+	return &s
+}
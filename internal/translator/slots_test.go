@@ -0,0 +1,238 @@
+package translator
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaskSegments(t *testing.T) {
+	tests := []struct {
+		text     string
+		masked   string
+		slots    []string
+		verbatim bool
+	}{
+		{"Partly cloudy, with a low around 68.", "Partly cloudy, with a low around <n1/>.", []string{"68"}, false},
+		{"South southeast wind 5 to 10 mph.", "South southeast wind <n1/> to <n2/>.", []string{"5", "10 mph"}, false},
+		{"Chance of precipitation is 40%.", "Chance of precipitation is <n1/>.", []string{"40%"}, false},
+		{"Updated 6:45 pm EDT Jul 4, 2024", "Updated <n1/> EDT Jul <n2/>, <n3/>", []string{"6:45 pm", "4", "2024"}, false},
+		{"Sunrise at 6am on 2024-07-04", "Sunrise at <n1/> on <n2/>", []string{"6am", "2024-07-04"}, false},
+		{"Rain totals of 1.25 inches", "Rain totals of <n1/> inches", []string{"1.25"}, false},
+		// Placeholders keep their numbers; slots are numbered on their own.
+		{"<g1>High near 75°F</g1> then <x2/> rain", "<g1>High near <n1/></g1> then <x2/> rain", []string{"75°F"}, false},
+		// Whitespace around the core text is kept.
+		{" Low around 68.\n", " Low around <n1/>.\n", []string{"68"}, false},
+		{"H2O on the 1st floor", "H2O on the 1st floor", nil, false},
+		{"68°F", "68°F", nil, true},
+		{"<g1>5</g1> - <g2>10 mph</g2>", "<g1>5</g1> - <g2>10 mph</g2>", nil, true},
+		{"Keep <n1/> as is, 5 times", "Keep <n1/> as is, 5 times", nil, false},
+		{"No numbers", "No numbers", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			seg := &segment{source: tt.text}
+			maskSegments([]*segment{seg}, []*regexp.Regexp{numberPattern})
+			if seg.source != tt.masked || !reflect.DeepEqual(seg.slots, tt.slots) || seg.verbatim != tt.verbatim {
+				t.Errorf("Expected %q %q (verbatim %v), got %q %q (verbatim %v)", tt.masked, tt.slots, tt.verbatim, seg.source, seg.slots, seg.verbatim)
+			}
+		})
+	}
+}
+
+func TestMaskSegments_Fallback(t *testing.T) {
+	fallback := []*segment{{source: "Low around "}, {source: "68"}}
+	seg := &segment{source: "Low around <g1>68</g1>", fallback: fallback}
+	maskSegments([]*segment{seg}, []*regexp.Regexp{numberPattern})
+	if seg.source != "Low around <g1><n1/></g1>" {
+		t.Errorf("Expected the segment masked, got %q", seg.source)
+	}
+	if fallback[0].slots != nil || !fallback[1].verbatim {
+		t.Errorf("Expected the number-only fallback segment verbatim, got %+v", fallback[1])
+	}
+}
+
+func TestFillSlots(t *testing.T) {
+	slots := []string{"5", "10 mph"}
+	if got, err := fillSlots("Viento del sur de <n1/> a <n2/>.", slots); err != nil || got != "Viento del sur de 5 a 10 mph." {
+		t.Errorf("Unexpected result %q (%v)", got, err)
+	}
+	for _, translated := range []string{"de <n1/> a", "de <n1/> a <n2/> o <n2/>", "de <n1/> a <n3/>"} {
+		if _, err := fillSlots(translated, slots); err != errSlots {
+			t.Errorf("Expected errSlots for %q, got %v", translated, err)
+		}
+	}
+}
+
+func TestTranslate_TemplateSlots(t *testing.T) {
+	var calls atomic.Int64
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			calls.Add(1)
+			if text == "Wind <n1/> to <n2/>." {
+				return "Viento de <n1/> a <n2/>.", nil
+			}
+			// Loses the slot marker.
+			if text == "Low around <n1/>." {
+				return "Mínima de unos.", nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM, WithTemplateSlots())
+
+	input := `<p>Wind 5 to 10 mph.</p><p>Wind 10 to 15 mph.</p><p>Wind 0 to 5 mph.</p><p>Low around 68.</p>`
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment(""))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<p>Viento de 5 a 10 mph.</p><p>Viento de 10 a 15 mph.</p><p>Viento de 0 a 5 mph.</p><p>TR:Low around 68.</p>`
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	// One call per template, and for the template that lost its slot a
+	// retry, then a call for the text with its number.
+	if n := calls.Load(); n != 4 {
+		t.Errorf("Expected 4 model calls, got %d", n)
+	}
+}
+
+func TestTranslate_TemplateSlotsNumbersOnly(t *testing.T) {
+	var calls atomic.Int64
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			calls.Add(1)
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM, WithTemplateSlots())
+
+	// The numbers alone are not sent to the model, which could alter them.
+	input := `<td>75°F</td><td>68</td><td>High near 75°F</td>`
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment("tr"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<td>75°F</td><td>68</td><td>TR:High near 75°F</td>`
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 1 model call, got %d", n)
+	}
+}
+
+func TestMaskSpans_Protected(t *testing.T) {
+	patterns := append(DefaultProtectedPatterns, regexp.MustCompile(`ACME \w+`))
+	tests := []struct {
+		text  string
+		slots []string
+	}{
+		{"Storms until 4:00 PM CDT tonight", []string{"4:00 PM CDT"}},
+		{"Visit https://www.weather.gov/lot/. Thanks", []string{"https://www.weather.gov/lot/"}},
+		{"Write to w-lot.webmaster@noaa.gov today", []string{"w-lot.webmaster@noaa.gov"}},
+		{"Closed on I-55 near exit 12", []string{"I-55", "12"}},
+		{"Hello {name}, you have %d new {{ kind }} alerts", []string{"{name}", "%d", "{{ kind }}"}},
+		{"Powered by ACME Forecast at 5 am", []string{"ACME Forecast", "5 am"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			masked, slots := maskSpans(tt.text, patterns)
+			if !reflect.DeepEqual(slots, tt.slots) {
+				t.Errorf("Expected slots %q, got %q (%q)", tt.slots, slots, masked)
+			}
+			if filled, err := fillSlots(masked, slots); err != nil || filled != tt.text {
+				t.Errorf("Expected the text restored, got %q (%v)", filled, err)
+			}
+		})
+	}
+}
+
+func TestTranslate_ProtectedPatterns(t *testing.T) {
+	var calls atomic.Int64
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			calls.Add(1)
+			switch {
+			case text == "Call <n1/> now":
+				// Duplicates the token until asked for a fresh
+				// translation.
+				if MemoryPolicyFromContext(ctx) != MemoryRefresh {
+					return "Llame <n1/> <n1/> ahora", nil
+				}
+				return "Llame <n1/> ahora", nil
+			case strings.Contains(text, "<n1/>"):
+				return "Lost it", nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM, WithProtectedPatterns())
+
+	input := `<p>Call {name} now</p><p>Go to https://example.com/a today</p>`
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es",
+		WithFragment(""), WithFailureMode(BestEffort))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<p>Llame {name} ahora</p><p>Go to https://example.com/a today</p>`
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	want := []SegmentFailure{{Segment: 1, Path: "/p[2]", Error: errSlots.Error()}}
+	if !reflect.DeepEqual(metadata.Failures, want) {
+		t.Errorf("Expected failures %+v, got %+v", want, metadata.Failures)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("Expected each segment translated twice, got %d calls", n)
+	}
+}
+
+func TestTranslate_ProtectedFallback(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			mu.Lock()
+			calls[text]++
+			mu.Unlock()
+			switch {
+			case strings.Contains(text, "<g1>"):
+				// Loses the first slot marker.
+				return "Llame <g1></g1> a las <n2/>", nil
+			case text == "at <n1/>":
+				return "a las <n1/>", nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM, WithProtectedPatterns())
+
+	paragraph := `<p>Call <b>{name}</b> at 5 pm</p>`
+	input := `<p>https://example.com/a</p>` + paragraph + paragraph
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment(""))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	// The inline segments fall back to their text nodes, masked too; the
+	// URL and the placeholder are kept without a model call.
+	fallback := `<p>TR:Call <b>{name}</b> a las 5 pm</p>`
+	if expected := `<p>https://example.com/a</p>` + fallback + fallback; translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	if metadata.Failures != nil {
+		t.Errorf("Expected no failures, got %+v", metadata.Failures)
+	}
+	want := map[string]int{"Call <g1><n1/></g1> at <n2/>": 2, "Call": 2, "at <n1/>": 2}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Expected model calls %v, got %v", want, calls)
+	}
+}
@@ -2,24 +2,105 @@ package translator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
-	"golang.org/x/net/html"
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
 )
 
 // TranslationService defines the interface for translating XHTML content.
 type TranslationService interface {
-	Translate(ctx context.Context, r *strings.Reader, sourceLang, targetLang string) (string, Metadata, error)
+	Translate(ctx context.Context, r *strings.Reader, sourceLang, targetLang string, opts ...Option) (string, Metadata, error)
+}
+
+// Option configures a single Translate call.
+type Option func(*options)
+
+// options holds the per-call settings of Translate.
+type options struct {
+	format          Format
+	fragmentContext string
+	minimalDiff     bool
+	memory          MemoryPolicy
+	failureMode     FailureMode
+	markFailures    bool
+	priority        Priority
+}
+
+// WithFragment translates the input as a fragment, as if it were the
+// content of a contextElement element (e.g. "body", "tbody" or "ul"). The
+// output then has exactly the shape of the input, without the html, head
+// and body elements added to full documents. An empty contextElement
+// means "body".
+func WithFragment(contextElement string) Option {
+	return func(o *options) {
+		if contextElement == "" {
+			contextElement = "body"
+		}
+		o.fragmentContext = contextElement
+	}
+}
+
+// WithMinimalDiff splices the translations into the original input instead
+// of re-rendering the whole document: whitespace, attribute quoting, entity
+// encoding and tag casing outside the translated text stay byte-for-byte
+// identical, which keeps diffs of translated files reviewable.
+func WithMinimalDiff() Option {
+	return func(o *options) {
+		o.minimalDiff = true
+	}
+}
+
+// WithFormat selects how the input is parsed and serialized. The default
+// is FormatAuto.
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
 }
 
 // Metadata contains information about the translation process.
 type Metadata struct {
 	Duration  time.Duration `json:"duration" swaggertype:"primitive,integer"`
 	Model     string        `json:"model"`
+	Format    Format        `json:"format"`
 	Timestamp time.Time     `json:"timestamp"`
+	// Memory counts translation memory hits and misses; it is omitted when
+	// the LLMClient is not wrapped in a translation memory.
+	Memory *MemoryStats `json:"memory,omitempty"`
+	// Priority is the scheduling class the call ran in.
+	Priority Priority `json:"priority"`
+	// Rejected counts the segments left in the source language because
+	// the Validator rejected the model's output; they are listed in
+	// Failures too.
+	Rejected int `json:"rejected,omitempty"`
+	// Dedupe reports the segments that took the translation of an earlier
+	// segment with the same text instead of a model request of their own.
+	Dedupe DedupeStats `json:"dedupe"`
+	// PromptTemplate and PromptHash identify the prompt template the
+	// LLMClient built its prompts from, if it implements PromptTemplater.
+	PromptTemplate string `json:"prompt_template,omitempty"`
+	PromptHash     string `json:"prompt_hash,omitempty"`
+	// Failures lists the segments left in the source language in
+	// BestEffort mode, and in either mode those whose translation the
+	// Validator rejected.
+	Failures []SegmentFailure `json:"failures,omitempty"`
+	// GlossaryViolations lists the glossary terms whose mandated
+	// translation is missing from the translation of their segment, with
+	// WithGlossary.
+	GlossaryViolations []GlossaryViolation `json:"glossary_violations,omitempty"`
+	// Retries lists the segments whose model requests had to be retried,
+	// as reported by the LLMClient with RecordRetry. The retries of a
+	// batched request count for each of its segments.
+	Retries []SegmentRetries `json:"retries,omitempty"`
 }
 
 // LLMClient defines the interface for the language model client.
@@ -28,83 +109,423 @@ type LLMClient interface {
 	GetModelName() string
 }
 
+// PromptTemplater is implemented by LLM clients that build their prompts
+// from a template, so that translations can be traced to the exact prompt.
+type PromptTemplater interface {
+	// PromptTemplate returns the name and content hash of the template.
+	PromptTemplate() (name, hash string)
+}
+
 // Service implements TranslationService.
 type Service struct {
-	llm LLMClient
+	llm        LLMClient
+	attributes AttributePolicy
+	skip       []Selector
+	// batchTokens is the token budget of a batch: 0 disables batching and
+	// a negative value uses the budget of the LLMClient.
+	batchTokens int
+	validator   Validator
+	scheduler   *Scheduler
+	// masks match the spans masked into slot markers; protect is set if
+	// they are protected spans rather than template slots only.
+	masks    []*regexp.Regexp
+	protect  bool
+	glossary Glossary
+}
+
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithAttributePolicy sets the attributes translated along with text
+// content. A nil policy disables attribute translation.
+func WithAttributePolicy(policy AttributePolicy) ServiceOption {
+	return func(s *Service) {
+		s.attributes = policy
+	}
+}
+
+// WithSkipSelectors sets the selectors of elements left untranslated along
+// with their content, replacing DefaultSkipSelectors. Elements with
+// translate="no" or class="notranslate" are skipped regardless.
+func WithSkipSelectors(selectors []Selector) ServiceOption {
+	return func(s *Service) {
+		s.skip = selectors
+	}
+}
+
+// WithBatching sends several segments per model request when the LLMClient
+// implements BatchTranslator, packing segments in document order until
+// their estimated token count reaches tokenBudget. A tokenBudget of 0 uses
+// the client's own budget for its model.
+func WithBatching(tokenBudget int) ServiceOption {
+	return func(s *Service) {
+		if tokenBudget <= 0 {
+			tokenBudget = -1
+		}
+		s.batchTokens = tokenBudget
+	}
+}
+
+// WithValidator sets the check applied to every translation returned by the
+// model, replacing DefaultValidator. Segments whose translation is rejected
+// are left in the source language. A nil validator accepts any output.
+func WithValidator(v Validator) ServiceOption {
+	return func(s *Service) {
+		s.validator = v
+	}
 }
 
 // NewService creates a new TranslationService.
-func NewService(llm LLMClient) *Service {
-	return &Service{llm: llm}
+func NewService(llm LLMClient, opts ...ServiceOption) *Service {
+	s := &Service{
+		llm:        llm,
+		attributes: DefaultAttributePolicy,
+		skip:       DefaultSkipSelectors,
+		validator:  DefaultValidator,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.scheduler == nil {
+		s.scheduler = NewScheduler(DefaultConcurrency)
+	}
+	return s
+}
+
+// Stats reports the state of a Service.
+type Stats struct {
+	Scheduler SchedulerStats `json:"scheduler"`
+	// Cache counts the requests the LLMClient served without a model call
+	// of their own, if it implements CacheReporter.
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// CacheStats counts the translation requests of an LLMClient that shares
+// model calls between identical requests.
+type CacheStats struct {
+	Requests int64 `json:"requests"`
+	// Coalesced counts the requests that shared the model call of an
+	// identical request in flight, and Hits those served from the results
+	// of recent requests.
+	Coalesced int64 `json:"coalesced"`
+	Hits      int64 `json:"hits"`
+	// Entries is the number of results held.
+	Entries int `json:"entries"`
+}
+
+// CacheReporter is implemented by LLM clients that share model calls
+// between identical requests.
+type CacheReporter interface {
+	CacheStats() CacheStats
 }
 
-// Translate parses the XHTML, translates text nodes, and returns the result.
-func (s *Service) Translate(ctx context.Context, r *strings.Reader, sourceLang, targetLang string) (string, Metadata, error) {
+// Stats returns the current state of the service.
+func (s *Service) Stats() Stats {
+	st := Stats{Scheduler: s.scheduler.Stats()}
+	if cr, ok := s.llm.(CacheReporter); ok {
+		cs := cr.CacheStats()
+		st.Cache = &cs
+	}
+	return st
+}
+
+// Translate parses the XHTML, translates its text segments, and returns the result.
+func (s *Service) Translate(ctx context.Context, r *strings.Reader, sourceLang, targetLang string, opts ...Option) (string, Metadata, error) {
 	start := time.Now()
 
-	doc, err := html.Parse(r)
+	o := options{format: FormatAuto, memory: MemoryUse, failureMode: FailFast, priority: PriorityAuto}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return "", Metadata{}, fmt.Errorf("failed to read XHTML: %w", err)
+	}
+	doc, err := parseDocument(string(input), o)
 	if err != nil {
 		return "", Metadata{}, fmt.Errorf("failed to parse XHTML: %w", err)
 	}
 
-	// Channel to collect text nodes that need translation
-	type textNode struct {
-		n    *html.Node
-		text string
-	}
-	nodesToTranslate := make([]*textNode, 0)
+	mc := &memoryContext{policy: o.memory}
+	ctx = withMemoryContext(ctx, mc)
+	ctx = withSchedulerContext(ctx, s.scheduler)
 
-	var walk func(*html.Node)
-	walk = func(n *html.Node) {
-		if n.Type == html.TextNode {
-			trimmed := strings.TrimSpace(n.Data)
-			if trimmed != "" && n.Parent != nil && n.Parent.Data != "script" && n.Parent.Data != "style" {
-				nodesToTranslate = append(nodesToTranslate, &textNode{n: n, text: n.Data})
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			walk(c)
+	segs := collectSegments(doc.root, s.skip)
+	segs = append(segs, collectAttributeSegments(doc.root, s.attributes, s.skip)...)
+	setContext(segs)
+	for i, seg := range segs {
+		seg.index = i
+		for _, fb := range seg.fallback {
+			fb.index = i
 		}
 	}
-	walk(doc)
+	if len(s.masks) > 0 {
+		maskSegments(segs, s.masks)
+	}
+	// Repeated texts are translated once.
+	unique, dedupeStats := dedupe(segs)
+	j := &job{
+		service:     s,
+		sourceLang:  sourceLang,
+		targetLang:  targetLang,
+		isolateLTR:  lang.IsRTL(targetLang) && !lang.IsRTL(sourceLang),
+		failureMode: o.failureMode,
+	}
+
+	// The first error cancels the requests of the other segments.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstErr error
+	var errOnce sync.Once
 
-	// Process translations concurrently
-	// Limit concurrency to avoid overwhelming the local LLM
-	sem := make(chan struct{}, 5) // Adjust concurrency limit as needed
+	// Process translations concurrently, in the slots the scheduler
+	// grants this call.
+	priority := o.priority
+	if priority == PriorityAuto {
+		priority = PriorityInteractive
+		if len(segs) > interactiveSegments {
+			priority = PriorityBatch
+		}
+	}
+	q := s.scheduler.newQueue(priority)
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(nodesToTranslate))
 
-	for _, tn := range nodesToTranslate {
+	for _, batch := range j.batches(unique) {
 		wg.Add(1)
-		go func(tn *textNode) {
+		go func(batch []*segment) {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			translated, err := s.llm.TranslateText(ctx, tn.text, sourceLang, targetLang)
-			if err != nil {
-				errChan <- err
+			if q.acquire(ctx) != nil {
 				return
 			}
-			tn.n.Data = translated
-		}(tn)
+			defer q.release()
+
+			if err := j.translateBatch(ctx, batch); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(batch)
 	}
 
 	wg.Wait()
-	close(errChan)
 
-	if len(errChan) > 0 {
-		return "", Metadata{}, <-errChan
+	if firstErr != nil {
+		return "", Metadata{}, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return "", Metadata{}, err
+	}
+
+	if o.markFailures {
+		j.failures.mark(doc.root)
 	}
+	localize(doc, sourceLang, targetLang, s.skip)
 
 	var buf strings.Builder
-	if err := html.Render(&buf, doc); err != nil {
+	if err := doc.render(&buf); err != nil {
 		return "", Metadata{}, fmt.Errorf("failed to render translated XHTML: %w", err)
 	}
 
-	return buf.String(), Metadata{
+	metadata := Metadata{
 		Duration:  time.Since(start),
 		Model:     s.llm.GetModelName(),
+		Format:    doc.format,
 		Timestamp: time.Now(),
-	}, nil
+		Priority:  priority,
+		Memory:    mc.stats(),
+		Rejected:  int(j.rejected.Load()),
+		Dedupe:    dedupeStats,
+		Failures:  j.failures.list(doc.root),
+		Retries:   j.retries.list(),
+	}
+	metadata.GlossaryViolations = j.violations.list(doc.root)
+	if pt, ok := s.llm.(PromptTemplater); ok {
+		metadata.PromptTemplate, metadata.PromptHash = pt.PromptTemplate()
+	}
+	return buf.String(), metadata, nil
+}
+
+// job holds the state of a single Translate call.
+type job struct {
+	service    *Service
+	sourceLang string
+	targetLang string
+	// isolateLTR is set when translating from a left-to-right into a
+	// right-to-left language.
+	isolateLTR bool
+	// rejected counts the segments whose translation was rejected.
+	rejected    atomic.Int64
+	retries     retryLog
+	failureMode FailureMode
+	failures    failureLog
+	violations  violationLog
+
+	// mu serializes writes to the document; segments are translated
+	// concurrently but inline segments restructure shared parents.
+	mu sync.Mutex
+}
+
+// translateSegment translates seg and writes the result back. When the
+// translation is rejected (e.g. inline placeholders were lost), the
+// segment's fallback segments are translated one by one instead.
+func (j *job) translateSegment(ctx context.Context, seg *segment) error {
+	if seg.verbatim {
+		return nil
+	}
+	// Only the text between leading and trailing whitespace is sent: models
+	// strip or add whitespace freely, which glues words to adjacent inline
+	// elements or adds stray line breaks.
+	_, core, _ := splitSpace(seg.source)
+	hints := prompt.HintsFromContext(ctx)
+	hints.Context = seg.context
+	hints.Glossary = append(j.terms(core), hints.Glossary...)
+	ctx = withKeepLog(ctx, &keepLog{})
+	rc := &retryCounter{}
+	tctx := withRequestSize(withRetryCounter(prompt.WithHints(ctx, hints), rc), estimateTokens(core))
+	translated, err := j.service.llm.TranslateText(tctx, core, j.sourceLang, j.targetLang)
+	j.retries.add(rc, seg)
+	if err != nil {
+		return j.fail(ctx, err, append([]*segment{seg}, seg.dups...)...)
+	}
+	translated, err = j.validate(core, translated)
+	if errors.Is(err, ErrRejected) {
+		if !seg.rejectRetry {
+			return j.retryRejected(ctx, seg)
+		}
+		// The segment keeps its source text, as do its duplicates, in
+		// either failure mode.
+		j.rejected.Add(int64(1 + len(seg.dups)))
+		for _, s := range append([]*segment{seg}, seg.dups...) {
+			j.failures.add(s, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return j.fail(ctx, err, append([]*segment{seg}, seg.dups...)...)
+	}
+	return j.applySegment(ctx, seg, translated)
+}
+
+// retryRejected translates seg once more on its own after its translation
+// was rejected, bypassing stored translations.
+func (j *job) retryRejected(ctx context.Context, seg *segment) error {
+	retry := *seg
+	retry.rejectRetry = true
+	return j.translateSegment(withMemoryRefresh(ctx), &retry)
+}
+
+// validate checks the model's translation of source with the service's
+// Validator.
+func (j *job) validate(source, translated string) (string, error) {
+	if j.service.validator == nil {
+		return translated, nil
+	}
+	return j.service.validator(source, translated, j.targetLang)
+}
+
+// applySegment writes the translation of seg's core text back to seg and
+// its duplicates. A translation that loses inline placeholders falls back
+// to their fallback segments, and one that loses slot markers or misses
+// glossary terms is translated again, once for all of them. A translation
+// applied to all of them is accepted: the LLMClient may keep it for later
+// requests.
+func (j *job) applySegment(ctx context.Context, seg *segment, translated string) error {
+	group := append([]*segment{seg}, seg.dups...)
+	if seg.check != nil {
+		if err := seg.check(translated); err != nil {
+			return j.fallBack(ctx, err, group...)
+		}
+	}
+	if seg.slots != nil && checkSlots(translated, len(seg.slots)) != nil {
+		return j.slotsLost(ctx, seg)
+	}
+	if missing := j.missingTerms(seg, translated); missing != nil {
+		if retried, err := j.termsMissed(ctx, seg, missing); retried {
+			return err
+		}
+	}
+	accepted := true
+	for _, s := range group {
+		applied, err := j.applyText(ctx, s, translated)
+		if err != nil {
+			return err
+		}
+		accepted = accepted && applied
+	}
+	if accepted {
+		_, core, _ := splitSpace(seg.source)
+		accept(ctx, core)
+	}
+	return nil
+}
+
+// applyText writes translated back to seg, filling in the slots and
+// restoring the whitespace of seg, and reports whether it did. It falls
+// back to seg's fallback segments if the translation is rejected.
+func (j *job) applyText(ctx context.Context, seg *segment, translated string) (bool, error) {
+	if seg.slots != nil {
+		filled, err := fillSlots(translated, seg.slots)
+		if err != nil {
+			return false, j.fallBack(ctx, err, seg)
+		}
+		translated = filled
+	}
+	lead, _, trail := splitSpace(seg.source)
+	translated = strings.TrimFunc(translated, unicode.IsSpace)
+	if j.isolateLTR {
+		translated = isolateLTR(translated)
+	}
+	translated = lead + translated + trail
+	j.mu.Lock()
+	err := seg.apply(translated)
+	j.mu.Unlock()
+	if err != nil {
+		return false, j.fallBack(ctx, err, seg)
+	}
+	return true, nil
+}
+
+// fallBack translates the fallback segments of segs one by one after err
+// rejected their translation. Segments without fallback segments fail with
+// err.
+func (j *job) fallBack(ctx context.Context, err error, segs ...*segment) error {
+	for _, seg := range segs {
+		if len(seg.fallback) == 0 {
+			if err := j.fail(ctx, err, seg); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, fb := range seg.fallback {
+			if err := j.translateSegment(ctx, fb); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fail handles the failure of segs with err: in BestEffort mode the
+// segments are recorded and left in the source language, unless the call
+// itself was cancelled; otherwise err is returned.
+func (j *job) fail(ctx context.Context, err error, segs ...*segment) error {
+	if j.failureMode != BestEffort || ctx.Err() != nil {
+		return err
+	}
+	for _, seg := range segs {
+		j.failures.add(seg, err)
+	}
+	return nil
+}
+
+// splitSpace splits s into its leading whitespace, its core text and its
+// trailing whitespace.
+func splitSpace(s string) (lead, core, trail string) {
+	core = strings.TrimLeftFunc(s, unicode.IsSpace)
+	lead = s[:len(s)-len(core)]
+	core = strings.TrimRightFunc(core, unicode.IsSpace)
+	trail = s[len(lead)+len(core):]
+	return lead, core, trail
 }
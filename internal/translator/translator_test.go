@@ -6,6 +6,10 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/prompt"
 )
 
 // MockLLM is a mock implementation of LLMClient.
@@ -36,7 +40,7 @@ func TestTranslate_Structure(t *testing.T) {
 
 	input := `<div><h1>Hello</h1><p>World</p></div>`
 	// net/html adds html, head, and body tags if missing
-	expected := `<html><head></head><body><div><h1>TR:Hello</h1><p>TR:World</p></div></body></html>`
+	expected := `<html lang="es"><head></head><body><div><h1>TR:Hello</h1><p>TR:World</p></div></body></html>`
 
 	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
 	if err != nil {
@@ -101,3 +105,291 @@ func TestTranslate_Concurrency(t *testing.T) {
 		t.Errorf("Max concurrent requests was %d, expected > 1", maxConcurrent)
 	}
 }
+
+func TestTranslate_InlineSegment(t *testing.T) {
+	var calls []string
+	var mu sync.Mutex
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			mu.Lock()
+			calls = append(calls, text)
+			mu.Unlock()
+			if text == `Click <g1>here</g1> to see the <g2>forecast</g2>` {
+				// Reorder the inline elements, as the target language would.
+				return `Vea el <g2>pronóstico</g2> <g1>aquí</g1>`, nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	input := `<p>Click <a href="/f">here</a> to see the <b>forecast</b></p>`
+	expected := `<html lang="es"><head></head><body><p>Vea el <b>pronóstico</b> <a href="/f">aquí</a></p></body></html>`
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+	if len(calls) != 1 {
+		t.Errorf("Expected a single call for the paragraph, got %d: %q", len(calls), calls)
+	}
+}
+
+func TestTranslate_InlineSegmentVoidElements(t *testing.T) {
+	mockLLM := &MockLLM{ModelName: "test-model"}
+	service := NewService(mockLLM)
+
+	input := `<div><b>Tonight</b><br/>Partly cloudy<!-- note --> and <i>calm</i>.</div>`
+	expected := `<html lang="es"><head></head><body><div>TRANSLATED_<b>Tonight</b><br/>Partly cloudy<!-- note --> and <i>calm</i>.</div></body></html>`
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+}
+
+func TestTranslate_InlineSegmentFallback(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			if strings.Contains(text, "<g") {
+				// Drop the placeholders, as small models often do.
+				return "Haga clic aquí", nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	input := `<p>Click <a href="/f">here</a> now</p>`
+	expected := `<html lang="es"><head></head><body><p>TR:Click <a href="/f">TR:here</a> TR:now</p></body></html>`
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+}
+
+func TestInlineSegment_RejectsBrokenPlaceholders(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>a <b>b</b> c <br/> d</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs := collectSegments(doc, nil)
+	if len(segs) != 1 {
+		t.Fatalf("Expected 1 segment, got %d", len(segs))
+	}
+	if want := `a <g1>b</g1> c <x2/> d`; segs[0].source != want {
+		t.Fatalf("Expected source %q, got %q", want, segs[0].source)
+	}
+
+	for _, bad := range []string{
+		`a b c d`,                       // placeholders dropped
+		`a <g1>b</g1> c d`,              // void placeholder dropped
+		`a <g1>b</g1> <g1>b</g1> <x2/>`, // duplicated
+		`a <g1>b <x2/> c`,               // unclosed
+		`a </g1>b<g1> <x2/>`,            // closed before opened
+		`a <g1>b</g1> <x2/> <x3/>`,      // unknown placeholder
+		`a <x1/> <g2>b</g2>`,            // kinds swapped
+	} {
+		if err := segs[0].apply(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestTranslate_Attributes(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	input := `<html lang="es"><head>` +
+		`<meta name="description" content="Forecast"/>` +
+		`<meta property="og:title" content="Weather"/>` +
+		`<meta name="viewport" content="width=device-width"/>` +
+		`</head><body>` +
+		`<img src="sun.png" alt="Sunny" title="Today"/>` +
+		`<input type="submit" value="Go"/><input type="text" value="keep" placeholder="City"/>` +
+		`<button aria-label="Close">x</button>` +
+		`<script title="s">var a;</script>` +
+		`</body></html>`
+	expected := `<html lang="es"><head>` +
+		`<meta name="description" content="TR:Forecast"/>` +
+		`<meta property="og:title" content="TR:Weather"/>` +
+		`<meta name="viewport" content="width=device-width"/>` +
+		`</head><body>` +
+		`<img src="sun.png" alt="TR:Sunny" title="TR:Today"/>` +
+		`<input type="submit" value="TR:Go"/><input type="text" value="keep" placeholder="TR:City"/>` +
+		`<button aria-label="TR:Close">TR:x</button>` +
+		`<script title="s">var a;</script>` +
+		`</body></html>`
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+}
+
+func TestTranslate_AttributePolicy(t *testing.T) {
+	mockLLM := &MockLLM{ModelName: "test-model"}
+	service := NewService(mockLLM, WithAttributePolicy(AttributePolicy{
+		{Element: "a", Attribute: "data-tooltip"},
+	}))
+
+	input := `<a href="/x" data-tooltip="More" title="Link">x</a>`
+	expected := `<html lang="es"><head></head><body><a href="/x" data-tooltip="TRANSLATED_More" title="Link">TRANSLATED_x</a></body></html>`
+
+	translated, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if translated != expected {
+		t.Errorf("Expected %q, got %q", expected, translated)
+	}
+}
+
+func TestTranslate_Fragment(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return "TR:" + text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	tests := []struct {
+		name     string
+		input    string
+		context  string
+		opts     []Option
+		expected string
+	}{
+		{
+			name:     "body",
+			input:    `<div><h1>Hello</h1><p>World</p></div>`,
+			expected: `<div><h1>TR:Hello</h1><p>TR:World</p></div>`,
+		},
+		{
+			name:     "text and siblings",
+			input:    "Intro <b>bold</b>\n<p>Para</p>",
+			expected: "TR:Intro <b>bold</b>\n<p>TR:Para</p>",
+		},
+		{
+			name:     "table rows",
+			input:    `<tr><td>Cell</td><td>Other</td></tr>`,
+			context:  "tbody",
+			expected: `<tr><td>TR:Cell</td><td>TR:Other</td></tr>`,
+		},
+		{
+			name:     "list items",
+			input:    `<li>One</li><li>Two</li>`,
+			context:  "ul",
+			expected: `<li>TR:One</li><li>TR:Two</li>`,
+		},
+		{
+			name:     "xhtml",
+			input:    `<p>Line<br />break</p><img src="a.png" alt="Sun" />`,
+			opts:     []Option{WithFormat(FormatXHTML)},
+			expected: `<p>TR:Line<br />break</p><img src="a.png" alt="TR:Sun" />`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithFragment(tt.context)}, tt.opts...)
+			translated, _, err := service.Translate(context.Background(), strings.NewReader(tt.input), "en", "es", opts...)
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if translated != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, translated)
+			}
+		})
+	}
+
+	if _, _, err := service.Translate(context.Background(), strings.NewReader(`<p>x</p>`), "en", "es", WithFragment("nonsense")); err == nil {
+		t.Error("Expected an error for an unknown context element")
+	}
+}
+
+// templatedLLM is a MockLLM that builds its prompts from a template.
+type templatedLLM struct {
+	MockLLM
+}
+
+func (m *templatedLLM) PromptTemplate() (name, hash string) {
+	return "instruct", "0123456789abcdef"
+}
+
+func TestTranslate_PromptHints(t *testing.T) {
+	var mu sync.Mutex
+	contexts := make(map[string]string)
+	mockLLM := &templatedLLM{MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			mu.Lock()
+			contexts[text] = prompt.HintsFromContext(ctx).Context
+			mu.Unlock()
+			return text, nil
+		},
+	}}
+	service := NewService(mockLLM)
+
+	input := `<div><h1>Tonight</h1><p>Mostly <b>clear</b>.</p><p>Wednesday</p></div>`
+	_, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "fr")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if metadata.PromptTemplate != "instruct" || metadata.PromptHash != "0123456789abcdef" {
+		t.Errorf("Expected the prompt template in the metadata, got %q %q", metadata.PromptTemplate, metadata.PromptHash)
+	}
+
+	want := map[string]string{
+		"Tonight":                "Mostly clear.",
+		"Mostly <g1>clear</g1>.": "Tonight\nWednesday",
+		"Wednesday":              "Mostly clear.",
+	}
+	for text, ctx := range want {
+		if contexts[text] != ctx {
+			t.Errorf("Expected context %q for %q, got %q", ctx, text, contexts[text])
+		}
+	}
+}
+
+func TestTranslate_Retries(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			if text == "World" {
+				RecordRetry(ctx)
+				RecordRetry(ctx)
+			}
+			return text, nil
+		},
+	}
+	service := NewService(mockLLM)
+
+	_, metadata, err := service.Translate(context.Background(), strings.NewReader(`<h1>Hello</h1><p>World</p>`), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if len(metadata.Retries) != 1 || metadata.Retries[0] != (SegmentRetries{Segment: 1, Retries: 2}) {
+		t.Errorf("Expected 2 retries of segment 1, got %+v", metadata.Retries)
+	}
+}
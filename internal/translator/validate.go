@@ -0,0 +1,181 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arihershowitz/translate-xhtml-local/internal/lang"
+)
+
+// ErrRejected is returned by a Validator for model output that is not a
+// usable translation.
+var ErrRejected = errors.New("translation rejected")
+
+// Validator checks the model's translation of source into targetLang. It
+// returns the translation, cleaned of anything that is safe to strip, or an
+// error wrapping ErrRejected if the output cannot be used.
+type Validator func(source, translated, targetLang string) (string, error)
+
+// DefaultValidator strips the conversational filler small models wrap
+// around translations (preambles, explanations, quoting, echoed source
+// text) and rejects echoed prompts and refusals.
+var DefaultValidator Validator = stripFiller
+
+// quoted matches text in a pair of quotation marks.
+const quoted = `["“„«「]([^"“”„«»「」]+)["”»」]`
+
+var (
+	// echoedPromptPattern matches the instructions of the prompt repeated
+	// in the output.
+	echoedPromptPattern = regexp.MustCompile(`(?i)\btranslate the [\p{L} (),-]{1,60}? texts? |return only the translat|keep the tags <g1>`)
+
+	// preamblePattern matches an announcement of the translation, e.g.
+	// "Sure, here is the translated string:".
+	preamblePattern = regexp.MustCompile(`(?is)^(?:(?:sure|certainly|of course|okay|ok)[,.!]?\s+)?(?:(?:here\s+is|here's|this\s+is|the)\s+(?:the\s+|a\s+|your\s+)?)?(?:translated\s+(?:string|text|phrase|sentence)|translation)(?:\s+(?:in|into|to)\s+[\p{L}-]+)?(?:\s+(?:is|would\s+be))?\s*:\s*`)
+
+	// labelPattern matches text starting with a label of a few words, e.g.
+	// "Traducción: el acto". The translation of such text starts with a
+	// label too, which is not a preamble in any language.
+	labelPattern = regexp.MustCompile(`^\s*\p{L}+(?:[ '’-]\p{L}+){0,3}\s*:`)
+
+	// translationWordPattern matches the word "translation" in the
+	// languages models use for their preambles.
+	translationWordPattern = regexp.MustCompile(`(?i)transl|tradu|übersetz|vertaal|vertal|перев|翻[译譯訳]|번역`)
+
+	// statedTranslationPattern matches a sentence stating the
+	// translation, e.g. `The translated string is "Jueves".`
+	statedTranslationPattern = regexp.MustCompile(`(?is)^(?:[\p{L}]+\s+){0,3}?transl\w*(?:\s+[\p{L}]+){0,3}\s+(?:is|are)\s*:?\s*` + quoted + `\s*[.。]?$`)
+
+	// explainedPattern matches an explanation of what the source means,
+	// e.g. `Wednesday Night is translated as "Noche de Miércoles" in
+	// Spanish.` or `Thursday in Spanish is "Jueves".`
+	explainedPattern = regexp.MustCompile(`(?is)^(.+?)\s+(?:in\s+[\p{L}-]+\s+)?(?:is|means)\s+(?:translated\s+(?:as|to|into)\s+)?` + quoted + `(?:\s+in\s+[\p{L}-]+)?\s*[.。]?$`)
+
+	// explainedUnquotedPattern matches `Thursday in zh is 四天。`.
+	explainedUnquotedPattern = regexp.MustCompile(`(?is)^(.+?)\s+in\s+[\p{L}-]+\s+is\s+(.+?)\s*[.。]?$`)
+
+	// wholeQuotedPattern matches text wrapped in quotation marks.
+	wholeQuotedPattern = regexp.MustCompile(`^` + quoted + `$`)
+
+	// paragraphBreak separates paragraphs of the output.
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+)
+
+// refusalPatterns match a refusal to translate, by the primary language
+// subtag of the language it is written in. Models refuse in English or in
+// the target language.
+var refusalPatterns = map[string]*regexp.Regexp{
+	"en": regexp.MustCompile(`(?i)\b(?:unable to|cannot|can ?not|can't|could not|couldn't)\s+(?:be\s+)?translat|\bno text (?:is|was) provided|\bnot provided in the context|\bi do not have access|\bi don't have access|\bas an ai\b`),
+	"de": regexp.MustCompile(`(?i)\bkann\b.*\bnicht\s+übersetz|\bnicht\s+übersetzt\s+werden`),
+	"es": regexp.MustCompile(`(?i)\bno\s+(?:puedo|es\s+posible)\s+traducir|\bno\s+se\s+puede\s+traducir`),
+	"fr": regexp.MustCompile(`(?i)\bne\s+(?:peux|puis)\s+pas\s+traduire|\bimpossible\s+de\s+traduire|\bpas\s+accès\s+à\s+l.{0,40}traduction`),
+	"it": regexp.MustCompile(`(?i)\bnon\s+(?:posso|riesco\s+a)\s+tradurre|\bimpossibile\s+tradurre`),
+	"ja": regexp.MustCompile(`翻訳(?:することが)?できません|翻訳できない`),
+	"ko": regexp.MustCompile(`번역할\s*수\s*없|번역이\s*불가`),
+	"nl": regexp.MustCompile(`(?i)\bkan\b.*\bniet\s+vertalen|\bniet\s+te\s+vertalen`),
+	"pt": regexp.MustCompile(`(?i)\bnão\s+(?:posso|consigo|é\s+possível)\s+traduzir|\bnão\s+(?:existem|há)\s+traduç`),
+	"ru": regexp.MustCompile(`(?i)не\s+могу\s+перевести|невозможно\s+перевести`),
+	"zh": regexp.MustCompile(`[无無]法翻[译譯]|不能翻[译譯]`),
+}
+
+// refuses reports whether text reads as a refusal to translate, in English
+// or in language targetLang.
+func refuses(text, targetLang string) bool {
+	if refusalPatterns["en"].MatchString(text) {
+		return true
+	}
+	p, ok := refusalPatterns[lang.Primary(targetLang)]
+	return ok && p.MatchString(text)
+}
+
+// rejected returns an error wrapping ErrRejected.
+func rejected(reason string) error {
+	return fmt.Errorf("%w: %s", ErrRejected, reason)
+}
+
+// stripFiller implements DefaultValidator.
+func stripFiller(source, translated, targetLang string) (string, error) {
+	t := strings.TrimSpace(translated)
+	if t == "" {
+		return "", rejected("empty output")
+	}
+	if echoedPromptPattern.MatchString(t) && !echoedPromptPattern.MatchString(source) {
+		return "", rejected("prompt echoed")
+	}
+	if refuses(t, targetLang) && !refuses(source, targetLang) {
+		return "", rejected("refusal")
+	}
+
+	// A final paragraph stating the translation makes everything before it
+	// an explanation.
+	paragraphs := paragraphBreak.Split(t, -1)
+	if m := statedTranslationPattern.FindStringSubmatch(paragraphs[len(paragraphs)-1]); m != nil && !statedTranslationPattern.MatchString(source) {
+		return m[1], nil
+	}
+
+	// Drop the source text echoed as a paragraph of its own, then any
+	// preamble announcing the translation.
+	for len(paragraphs) > 1 && sameText(paragraphs[0], source) {
+		paragraphs = paragraphs[1:]
+	}
+	if len(paragraphs) > 1 && strings.HasSuffix(strings.TrimSpace(paragraphs[0]), ":") &&
+		(translationWordPattern.MatchString(paragraphs[0]) || strings.Contains(paragraphs[0], source)) {
+		paragraphs = paragraphs[1:]
+	}
+	t = strings.Join(paragraphs, "\n\n")
+	labeled := labelPattern.MatchString(source) || preamblePattern.MatchString(source)
+	if loc := preamblePattern.FindStringIndex(t); loc != nil && loc[1] < len(t) && !labeled {
+		t = t[loc[1]:]
+	}
+
+	if m := explainedPattern.FindStringSubmatch(t); m != nil && sameText(m[1], source) {
+		t = m[2]
+	} else if m := explainedUnquotedPattern.FindStringSubmatch(t); m != nil && sameText(m[1], source) {
+		t = m[2]
+	}
+
+	t = unwrap(source, strings.TrimSpace(t))
+	if t == "" {
+		return "", rejected("empty output")
+	}
+	if preamblePattern.MatchString(t) && !labeled {
+		return "", rejected("preamble")
+	}
+	// "Tonight is a night in the future." explains the source instead of
+	// translating it.
+	lower, src := strings.ToLower(t), strings.ToLower(source)
+	if len(t) > len(source) && (strings.HasPrefix(lower, src+" is ") || strings.HasPrefix(lower, src+" in ")) {
+		return "", rejected("explanation")
+	}
+	return t, nil
+}
+
+// unwrap removes markdown emphasis and quotation marks wrapped around the
+// whole translation, unless the source was wrapped the same way.
+func unwrap(source, t string) string {
+	for {
+		s := t
+		if inner, ok := strings.CutPrefix(t, "**"); ok && !strings.HasPrefix(source, "**") {
+			if inner, ok := strings.CutSuffix(inner, "**"); ok {
+				t = strings.TrimSpace(inner)
+			}
+		}
+		if m := wholeQuotedPattern.FindStringSubmatch(t); m != nil && !wholeQuotedPattern.MatchString(source) {
+			t = strings.TrimSpace(m[1])
+		}
+		if t == s {
+			return t
+		}
+	}
+}
+
+// sameText reports whether a and b are the same text, ignoring case,
+// surrounding quotes and whitespace.
+func sameText(a, b string) bool {
+	clean := func(s string) string {
+		return strings.Join(strings.Fields(strings.Trim(strings.TrimSpace(s), `"“”„«»「」'`)), " ")
+	}
+	return strings.EqualFold(clean(a), clean(b))
+}
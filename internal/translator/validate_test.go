@@ -0,0 +1,267 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestStripFiller(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		translated string
+		lang       string
+		expected   string
+		wantErr    bool
+	}{
+		{"clean", "Tonight", "Esta noche", "es", "Esta noche", false},
+		{"whitespace", "Tonight", "  Esta noche\n", "es", "Esta noche", false},
+		{"preamble", "Thursday", "Sure, here is the translated string:\n\nJueves", "es", "Jueves", false},
+		{"preamble inline", "Thursday", "Here is the translation: Jueves", "es", "Jueves", false},
+		{"preamble quoted", "A 20 percent chance", "Sure, here is the translated string:\n\n\"Una probabilidad del 20 por ciento\"", "es", "Una probabilidad del 20 por ciento", false},
+		{"stated", "Thursday", "The translated string is \"Jueves\".", "es", "Jueves", false},
+		{"echo then stated", "Wednesday", "Wednesday\n\nThe translated string is \"Woensdag\".", "nl", "Woensdag", false},
+		{"echo then preamble", "Last Update", "Last Update\n\nThe translated string is:\n\nÚltima actualización", "es", "Última actualización", false},
+		{"explained", "Wednesday Night", "Wednesday Night is translated as \"Noche de Miércoles\" in Spanish.", "es", "Noche de Miércoles", false},
+		{"explained language first", "Thursday", "Thursday in Spanish is “Jueves”.", "es", "Jueves", false},
+		{"explained unquoted", "Thursday", "Thursday in zh is 四天。", "zh", "四天", false},
+		{"foreign preamble", "Mostly cloudy", "Le texte anglais \"Mostly cloudy\" est traduit en français comme :\n\n\"Plutôt nuageux\"", "fr", "Plutôt nuageux", false},
+		{"markdown", "Detailed Forecast", "**Previsioni dettagliate**", "it", "Previsioni dettagliate", false},
+		{"quotes kept", `"Quoted"`, `"Citado"`, "es", `"Citado"`, false},
+		{"colon kept", "Note: bring water", "Nota: traiga agua", "es", "Nota: traiga agua", false},
+		{"label in source kept", "Traducción: el acto", "Translation: the act", "en", "Translation: the act", false},
+		{"refusal", "Detailed Forecast", "I am unable to translate the text \"Detailed Forecast\" to ko.", "ko", "", true},
+		{"refusal in target", "Detailed Forecast", "Ich kann den Text \"Detailed Forecast\" nicht übersetzen.", "de", "", true},
+		{"refusal in source kept", "I cannot translate this", "No puedo traducir esto", "es", "No puedo traducir esto", false},
+		{"echoed prompt", "Hi", "Translate the english text \"Hi\" to es. return only the translated string.", "es", "", true},
+		{"explanation", "Tonight", "Tonight is a night in the future.", "ja", "", true},
+		{"empty", "Tonight", " \n", "es", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripFiller(tt.source, tt.translated, tt.lang)
+			if tt.wantErr {
+				if !errors.Is(err, ErrRejected) {
+					t.Fatalf("Expected ErrRejected, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripFiller failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// fillerPattern matches the conversational filler found in output_samples.
+var fillerPattern = regexp.MustCompile(`(?i)sure,|\bhere is|translated|translation|unable|cannot|can't|\bis "|\bin (?:spanish|french|german|dutch|portuguese|korean|japanese|ru|ja|ko|zh)\b|future`)
+
+// TestStripFiller_OutputSamples runs the validator over the model output
+// kept in output_samples, paired text node by text node with the source
+// document it was produced from: every accepted translation must be free of
+// filler.
+func TestStripFiller_OutputSamples(t *testing.T) {
+	source := textNodes(t, filepath.Join("..", "..", "test", "integration", "data", "sample.xhtml"))
+	files, err := filepath.Glob(filepath.Join("..", "..", "output_samples", "sample_*.xhtml"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No output samples found: %v", err)
+	}
+
+	// Spot checks of segments the validator must recover.
+	expected := map[string]string{
+		"es/Wednesday Night": "Noche de Miércoles",
+		"es/Thursday":        "Jueves",
+		"es/A 20 percent chance of showers and thunderstorms after 1pm. Partly sunny, with a high near 90.": "A 20% chance of showers and thunderstorms after 1pm. Partly sunny, with a high near 90.",
+		"es/National Weather Service - Austin/San Antonio, TX":                                              "Servicio Meteorologico Nacional - Austin/San Antonio, TX",
+		"it/Detailed Forecast": "Detailed Forecast",
+		"nl/Wednesday":         "Woensdag",
+		"nl/Detailed Forecast": "Belangrijk voorspel",
+		"nl/National Weather Service - Austin/San Antonio, TX": "National Weather Service - Austin/San Antonio, TX",
+		"pt/Last Update: 4:00 PM CDT Jun 18, 2026":             "A última atualização: 18 de Junho de 2026 às 4:00 UTC",
+		"zh/Thursday": "四天",
+		"ru/Tonight":  "Tonight",
+	}
+	rejected := map[string]bool{
+		"de/National Weather Service - Austin/San Antonio, TX": true,
+		"de/Detailed Forecast":                                 true,
+		"es/Detailed Forecast":                                 true,
+		"fr/Detailed Forecast":                                 true,
+		"fr/Wednesday Night":                                   true,
+		"ja/Tonight":                                           true,
+		"ko/Wednesday":                                         true,
+		"zh/Detailed Forecast":                                 true,
+	}
+
+	for _, file := range files {
+		lang := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "sample_"), ".xhtml")
+		output := textNodes(t, file)
+		if len(output) != len(source) {
+			t.Fatalf("%s: %d text nodes, want %d", file, len(output), len(source))
+		}
+		for i, src := range source {
+			key := lang + "/" + src
+			got, err := stripFiller(src, output[i], lang)
+			if err != nil {
+				if !errors.Is(err, ErrRejected) {
+					t.Errorf("%s: unexpected error %v", key, err)
+				}
+				if want, ok := expected[key]; ok {
+					t.Errorf("%s: expected %q, got %v", key, want, err)
+				}
+				continue
+			}
+			if rejected[key] {
+				t.Errorf("%s: expected a rejection, got %q", key, got)
+			}
+			if want, ok := expected[key]; ok && got != want {
+				t.Errorf("%s: expected %q, got %q", key, want, got)
+			}
+			if fillerPattern.MatchString(got) && !fillerPattern.MatchString(src) {
+				t.Errorf("%s: filler left in %q", key, got)
+			}
+		}
+	}
+}
+
+// textNodes returns the non-blank text nodes of the document at path,
+// trimmed and with whitespace runs inside paragraphs collapsed.
+func textNodes(t *testing.T, path string) []string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	doc, err := html.Parse(strings.NewReader(string(content)))
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", path, err)
+	}
+	var texts []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode && strings.TrimSpace(n.Data) != "" {
+			paragraphs := paragraphBreak.Split(strings.TrimSpace(n.Data), -1)
+			for i, p := range paragraphs {
+				paragraphs[i] = strings.Join(strings.Fields(p), " ")
+			}
+			texts = append(texts, strings.Join(paragraphs, "\n\n"))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return texts
+}
+
+func TestTranslate_Validator(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			switch text {
+			case "Hello":
+				return "Sure, here is the translated string:\n\nHola", nil
+			case "World":
+				return "I cannot translate \"World\".", nil
+			}
+			return "TR:" + text, nil
+		},
+	}
+
+	service := NewService(mockLLM)
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(`<h1>Hello</h1><p>World</p><p>Bye</p>`), "en", "es", WithFragment("body"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	expected := `<h1>Hola</h1><p>World</p><p>TR:Bye</p>`
+	if translated != expected {
+		t.Errorf("Expected %s, got %s", expected, translated)
+	}
+	if metadata.Rejected != 1 {
+		t.Errorf("Expected 1 rejected segment, got %d", metadata.Rejected)
+	}
+	if len(metadata.Failures) != 1 || metadata.Failures[0].Path != "/p[1]" || !strings.Contains(metadata.Failures[0].Error, "refusal") {
+		t.Errorf("Expected the rejected segment among the failures, got %+v", metadata.Failures)
+	}
+	translated, _, err = service.Translate(context.Background(), strings.NewReader(`<p>World</p>`), "en", "es", WithFragment("body"), WithFailureMarking())
+	if expected := `<p data-translation-failed="content">World</p>`; err != nil || translated != expected {
+		t.Errorf("Expected %s, got %s (%v)", expected, translated, err)
+	}
+
+	service = NewService(mockLLM, WithValidator(nil))
+	translated, _, err = service.Translate(context.Background(), strings.NewReader(`<p>World</p>`), "en", "es", WithFragment("body"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if expected := `<p>I cannot translate &#34;World&#34;.</p>`; translated != expected {
+		t.Errorf("Expected %s, got %s", expected, translated)
+	}
+}
+
+func TestTranslate_ValidatorErrorBestEffort(t *testing.T) {
+	mockLLM := &MockLLM{
+		ModelName: "test-model",
+		TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+			return "TR:" + text, nil
+		},
+	}
+	errCheck := errors.New("check failed")
+	validator := func(source, translated, targetLang string) (string, error) {
+		if source == "World" {
+			return "", errCheck
+		}
+		return translated, nil
+	}
+	service := NewService(mockLLM, WithValidator(validator))
+
+	input := `<p>Hello</p><p>World</p>`
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment("body"), WithFailureMode(BestEffort))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if expected := `<p>TR:Hello</p><p>World</p>`; translated != expected {
+		t.Errorf("Expected %s, got %s", expected, translated)
+	}
+	if len(metadata.Failures) != 1 || metadata.Failures[0].Error != errCheck.Error() {
+		t.Errorf("Expected the validator error as a failure, got %+v", metadata.Failures)
+	}
+	if _, _, err := service.Translate(context.Background(), strings.NewReader(input), "en", "es", WithFragment("body")); !errors.Is(err, errCheck) {
+		t.Errorf("Expected the validator error in fail-fast mode, got %v", err)
+	}
+}
+
+func TestTranslate_BatchRejectionRetried(t *testing.T) {
+	mockLLM := &MockBatchLLM{
+		MockLLM: MockLLM{
+			ModelName: "test-model",
+			TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+				return "TR:" + text, nil
+			},
+		},
+		Budget: 100,
+		BatchFunc: func(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+			return []string{"B:One", "One in Spanish is \"Uno\"... I cannot translate Two."}, nil
+		},
+	}
+	service := NewService(mockLLM, WithBatching(0))
+
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(`<p>One</p><p>Two</p>`), "en", "es", WithFragment("body"))
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if expected := `<p>B:One</p><p>TR:Two</p>`; translated != expected {
+		t.Errorf("Expected %s, got %s", expected, translated)
+	}
+	if metadata.Rejected != 0 {
+		t.Errorf("Expected no rejected segments, got %d", metadata.Rejected)
+	}
+}
@@ -0,0 +1,112 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSplitSpace(t *testing.T) {
+	tests := []struct {
+		in, lead, core, trail string
+	}{
+		{"Hello", "", "Hello", ""},
+		{"\n\t\tPartly cloudy.\n\t", "\n\t\t", "Partly cloudy.", "\n\t"},
+		{" to see the ", " ", "to see the", " "},
+		{" Lat: ", " ", "Lat:", " "},
+		{"   ", "   ", "", ""},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		lead, core, trail := splitSpace(tt.in)
+		if lead != tt.lead || core != tt.core || trail != tt.trail {
+			t.Errorf("splitSpace(%q) = %q, %q, %q; want %q, %q, %q", tt.in, lead, core, trail, tt.lead, tt.core, tt.trail)
+		}
+	}
+}
+
+// TestTranslate_Whitespace checks that spacing around inline elements
+// survives models that trim their input or pad their output, both when the
+// paragraph is translated as one placeholder segment and when it falls back
+// to one call per text node.
+func TestTranslate_Whitespace(t *testing.T) {
+	models := map[string]func(text string) string{
+		// Keeps placeholders, trims and pads with stray line breaks.
+		"placeholders": func(text string) string {
+			return "\n" + upperText(text) + " \n"
+		},
+		// Drops placeholders, forcing per-node fallback, and pads.
+		"fallback": func(text string) string {
+			if placeholderPattern.MatchString(text) {
+				return "no placeholders"
+			}
+			return "  " + upperText(text) + "\n\n"
+		},
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "link inside sentence",
+			input:    `<p>Click <a href="/f">here</a> to see the <b>forecast</b> now.</p>`,
+			expected: `<p>CLICK <a href="/f">HERE</a> TO SEE THE <b>FORECAST</b> NOW.</p>`,
+		},
+		{
+			name:     "bold label and line break",
+			input:    "<div>\n\t<b>Tonight</b><br/>\n\tPartly cloudy, with a low around 68.\n</div>",
+			expected: "<div>\n\t<b>TONIGHT</b><br/>\n\tPARTLY CLOUDY, WITH A LOW AROUND 68.\n</div>",
+		},
+		{
+			name:     "spaces inside inline element",
+			input:    `<p>Wind <b> 5 mph </b>gusting <a href="#g">to 20</a>.</p>`,
+			expected: `<p>WIND <b> 5 MPH </b>GUSTING <a href="#g">TO 20</a>.</p>`,
+		},
+		{
+			name:     "nested inline",
+			input:    `<p>A <a href="/x"><b>bold</b> link</a> here</p>`,
+			expected: `<p>A <a href="/x"><b>BOLD</b> LINK</a> HERE</p>`,
+		},
+		{
+			name:     "non-breaking space",
+			input:    "<p><b>Lat: </b>30.32°N <i>approx</i></p>",
+			expected: "<p><b>LAT: </b>30.32°N <i>APPROX</i></p>",
+		},
+	}
+
+	for model, translate := range models {
+		translate := translate
+		service := NewService(&MockLLM{
+			ModelName: "test-model",
+			TranslateFunc: func(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+				return translate(text), nil
+			},
+		})
+		for _, tt := range tests {
+			t.Run(model+"/"+tt.name, func(t *testing.T) {
+				translated, _, err := service.Translate(context.Background(), strings.NewReader(tt.input), "en", "es", WithFragment(""))
+				if err != nil {
+					t.Fatalf("Translate failed: %v", err)
+				}
+				if translated != tt.expected {
+					t.Errorf("Expected %q, got %q", tt.expected, translated)
+				}
+			})
+		}
+	}
+}
+
+// upperText upper-cases text, leaving inline placeholders intact.
+func upperText(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(strings.ToUpper(text[last:m[0]]))
+		b.WriteString(text[m[0]:m[1]])
+		last = m[1]
+	}
+	b.WriteString(strings.ToUpper(text[last:]))
+	return b.String()
+}
@@ -0,0 +1,199 @@
+package translator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// xhtmlNamespace is the XML namespace of XHTML elements.
+const xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+
+// xhtmlRootPattern matches a root element declaring the XHTML namespace as
+// its default namespace.
+var xhtmlRootPattern = regexp.MustCompile(`<html\b[^>]*\sxmlns\s*=\s*["']` + regexp.QuoteMeta(xhtmlNamespace) + `["']`)
+
+// voidElements never have content. They are the only elements serialized
+// as empty-element tags in XHTML output, as recommended for compatibility
+// with HTML user agents.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "param": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// looksLikeXHTML reports whether input starts with an XML declaration or
+// has a root element in the XHTML namespace.
+func looksLikeXHTML(input string) bool {
+	trimmed := strings.TrimLeft(strings.TrimPrefix(input, "\ufeff"), " \t\r\n")
+	if strings.HasPrefix(trimmed, "<?xml") {
+		return true
+	}
+	return xhtmlRootPattern.MatchString(input)
+}
+
+// parseXHTML parses input as XML into an html.Node tree. Element and
+// attribute prefixes are kept in the Namespace fields so that the document
+// can be serialized back with its original qualified names. Everything
+// before the root element (XML declaration, doctype, comments) is returned
+// verbatim as prolog, everything after it as epilog.
+func parseXHTML(input string) (root *html.Node, prolog, epilog string, err error) {
+	d := xml.NewDecoder(strings.NewReader(input))
+	d.Strict = true
+	d.Entity = xml.HTMLEntity
+
+	root = &html.Node{Type: html.DocumentNode}
+	stack := []*html.Node{root}
+	seenRoot := false
+	for {
+		offset := d.InputOffset()
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", "", err
+		}
+		top := stack[len(stack)-1]
+		if len(stack) == 1 {
+			// Outside the root element only markup is preserved, verbatim.
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if seenRoot {
+					return nil, "", "", fmt.Errorf("multiple root elements")
+				}
+				seenRoot = true
+				prolog = input[:offset]
+				n := xmlElement(t)
+				top.AppendChild(n)
+				stack = append(stack, n)
+			case xml.EndElement:
+				return nil, "", "", fmt.Errorf("unexpected end element </%s>", qualifiedName(t.Name))
+			case xml.CharData:
+				if strings.TrimSpace(string(t)) != "" {
+					return nil, "", "", fmt.Errorf("text outside the root element")
+				}
+			}
+			continue
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := xmlElement(t)
+			top.AppendChild(n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if t.Name.Local != top.Data || t.Name.Space != top.Namespace {
+				return nil, "", "", fmt.Errorf("element <%s> closed by </%s>", qualifiedName(xml.Name{Space: top.Namespace, Local: top.Data}), qualifiedName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 1 {
+				epilog = input[d.InputOffset():]
+			}
+		case xml.CharData:
+			top.AppendChild(&html.Node{Type: html.TextNode, Data: string(t)})
+		case xml.Comment:
+			top.AppendChild(&html.Node{Type: html.CommentNode, Data: string(t)})
+		case xml.ProcInst, xml.Directive:
+			top.AppendChild(&html.Node{Type: html.RawNode, Data: input[offset:d.InputOffset()]})
+		}
+	}
+	if !seenRoot {
+		return nil, "", "", fmt.Errorf("no root element")
+	}
+	if len(stack) > 1 {
+		return nil, "", "", fmt.Errorf("unclosed element <%s>", stack[len(stack)-1].Data)
+	}
+	return root, prolog, epilog, nil
+}
+
+// xmlElement converts a raw start element into an element node.
+func xmlElement(t xml.StartElement) *html.Node {
+	n := &html.Node{Type: html.ElementNode, Data: t.Name.Local, Namespace: t.Name.Space}
+	for _, a := range t.Attr {
+		n.Attr = append(n.Attr, html.Attribute{Namespace: a.Name.Space, Key: a.Name.Local, Val: a.Value})
+	}
+	return n
+}
+
+// qualifiedName returns the prefixed name of an element or attribute.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// renderXHTML serializes the tree produced by parseXHTML as well-formed XML.
+func renderXHTML(w io.Writer, n *html.Node) error {
+	var b bytes.Buffer
+	writeXHTML(&b, n)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeXHTML(b *bytes.Buffer, n *html.Node) {
+	switch n.Type {
+	case html.DocumentNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeXHTML(b, c)
+		}
+	case html.TextNode:
+		if p := n.Parent; p != nil && p.Type == html.ElementNode && (p.Data == "script" || p.Data == "style") && strings.ContainsAny(n.Data, "<&") {
+			// Keep scripts and stylesheets readable by both XML and HTML parsers.
+			b.WriteString("<![CDATA[")
+			b.WriteString(strings.ReplaceAll(n.Data, "]]>", "]]]]><![CDATA[>"))
+			b.WriteString("]]>")
+			return
+		}
+		b.WriteString(escapeXMLText(n.Data))
+	case html.CommentNode:
+		b.WriteString("<!--")
+		b.WriteString(n.Data)
+		b.WriteString("-->")
+	case html.RawNode:
+		b.WriteString(n.Data)
+	case html.ElementNode:
+		name := qualifiedName(xml.Name{Space: n.Namespace, Local: n.Data})
+		b.WriteByte('<')
+		b.WriteString(name)
+		for _, a := range n.Attr {
+			b.WriteByte(' ')
+			b.WriteString(qualifiedName(xml.Name{Space: a.Namespace, Local: a.Key}))
+			b.WriteString(`="`)
+			b.WriteString(escapeXMLAttr(a.Val))
+			b.WriteByte('"')
+		}
+		if n.FirstChild == nil && voidElements[n.Data] {
+			b.WriteString(" />")
+			return
+		}
+		b.WriteByte('>')
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeXHTML(b, c)
+		}
+		b.WriteString("</")
+		b.WriteString(name)
+		b.WriteByte('>')
+	}
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\n", "&#10;", "\r", "&#13;", "\t", "&#9;")
+)
+
+// escapeXMLText escapes s for use as character data.
+func escapeXMLText(s string) string {
+	return xmlTextEscaper.Replace(s)
+}
+
+// escapeXMLAttr escapes s for use in a double-quoted attribute value.
+func escapeXMLAttr(s string) string {
+	return xmlAttrEscaper.Replace(s)
+}
@@ -0,0 +1,115 @@
+package translator
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+const xhtmlInput = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en">
+<head><title>Forecast</title><script type="text/javascript"><![CDATA[if (a < b) {}]]></script></head>
+<body>
+<p epub:type="note">Tonight<br />Partly cloudy &amp; calm.</p>
+<img src="a.png" alt="" />
+<div></div>
+</body>
+</html>
+`
+
+func TestTranslate_XHTML(t *testing.T) {
+	service := NewService(&MockLLM{ModelName: "test-model"})
+
+	translated, metadata, err := service.Translate(context.Background(), strings.NewReader(xhtmlInput), "en", "es")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if metadata.Format != FormatXHTML {
+		t.Errorf("Expected format %q, got %q", FormatXHTML, metadata.Format)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="es" lang="es">
+<head><title>TRANSLATED_Forecast</title><script type="text/javascript"><![CDATA[if (a < b) {}]]></script></head>
+<body>
+<p epub:type="note">TRANSLATED_Tonight<br />Partly cloudy &amp; calm.</p>
+<img src="a.png" alt="" />
+<div></div>
+</body>
+</html>
+`
+	if translated != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, translated)
+	}
+
+	// The output must be well-formed XML.
+	d := xml.NewDecoder(strings.NewReader(translated))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Output is not well-formed XML: %v", err)
+		}
+	}
+}
+
+func TestTranslate_FormatSelection(t *testing.T) {
+	service := NewService(&MockLLM{ModelName: "test-model"})
+
+	tests := []struct {
+		name     string
+		input    string
+		format   Format
+		expected Format
+		wantErr  bool
+	}{
+		{"auto html", `<div><p>Hi</p></div>`, FormatAuto, FormatHTML, false},
+		{"auto namespace", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Hi</p></body></html>`, FormatAuto, FormatXHTML, false},
+		{"auto declaration", `<?xml version="1.0"?><html><body><p>Hi</p></body></html>`, FormatAuto, FormatXHTML, false},
+		{"auto malformed", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Hi<br></p></body></html>`, FormatAuto, FormatHTML, false},
+		{"explicit html", `<?xml version="1.0"?><html><body><p>Hi</p></body></html>`, FormatHTML, FormatHTML, false},
+		{"explicit xhtml", `<div><p>Hi</p></div>`, FormatXHTML, FormatXHTML, false},
+		{"explicit malformed", `<div><p>Hi<br></p></div>`, FormatXHTML, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, metadata, err := service.Translate(context.Background(), strings.NewReader(tt.input), "en", "es", WithFormat(tt.format))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error for malformed XHTML")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if metadata.Format != tt.expected {
+				t.Errorf("Expected format %q, got %q", tt.expected, metadata.Format)
+			}
+		})
+	}
+}
+
+func TestRenderXHTML_Escaping(t *testing.T) {
+	root, prolog, epilog, err := parseXHTML(`<p title="a &quot;b&quot; &lt; c">x &lt; y &amp;&nbsp;z</p>`)
+	if err != nil {
+		t.Fatalf("parseXHTML failed: %v", err)
+	}
+	if prolog != "" || epilog != "" {
+		t.Errorf("Expected empty prolog and epilog, got %q and %q", prolog, epilog)
+	}
+	var b strings.Builder
+	if err := renderXHTML(&b, root); err != nil {
+		t.Fatalf("renderXHTML failed: %v", err)
+	}
+	expected := "<p title=\"a &quot;b&quot; &lt; c\">x &lt; y &amp;\u00a0z</p>"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
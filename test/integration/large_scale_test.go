@@ -79,7 +79,9 @@ func TestLargeScaleTranslation(t *testing.T) {
 	} else {
 		t.Log("Using MOCK LLM for translation tests. Set TEST_REAL_LLM=true to use real model.")
 		mockLLM := &MockLLM{ModelName: "mock-high-throughput"}
-		service = translator.NewService(mockLLM)
+		// The mock keeps up with as many requests as the files in flight
+		// can send, unlike a real model server.
+		service = translator.NewService(mockLLM, translator.WithScheduler(translator.NewScheduler(250)))
 	}
 
 	// Limit files for sampling if requested